@@ -3,6 +3,11 @@ package cmd
 
 import (
 	"flag"
+	"go/build"
+	"strings"
+	"time"
+
+	"github.com/nullstyle/mcdev/pkgwatch"
 )
 
 // IsGB signifies that this command is being run within the root of a GB project
@@ -12,3 +17,185 @@ var IsGB = flag.Bool(
 	false,
 	"determine changed packages using the gb build tool's project layout",
 )
+
+// Poll enables polling the filesystem for changes, for filesystems that don't
+// deliver native notifications such as bind-mounted volumes or NFS.
+var Poll = flag.Duration(
+	"poll",
+	0,
+	"poll the filesystem for changes at the provided interval instead of relying on native notifications",
+)
+
+// SkipUnchanged ignores changes that leave a go file's content unchanged
+var SkipUnchanged = flag.Bool(
+	"skip-unchanged",
+	true,
+	"ignore changes that leave a go file's content unchanged",
+)
+
+// IgnoreFormatting ignores changes that only affect comments or formatting
+var IgnoreFormatting = flag.Bool(
+	"ignore-formatting",
+	false,
+	"ignore changes that only affect a go file's comments or formatting",
+)
+
+// Constraints ignores changes to go files excluded from the build by their
+// build constraints
+var Constraints = flag.Bool(
+	"constraints",
+	false,
+	"ignore changes to go files excluded by build constraints for -goos, -goarch and -tags",
+)
+
+// GOOS is the target operating system used when evaluating build constraints
+var GOOS = flag.String("goos", "", "the GOOS used to evaluate build constraints (default $GOOS)")
+
+// GOARCH is the target architecture used when evaluating build constraints
+var GOARCH = flag.String("goarch", "", "the GOARCH used to evaluate build constraints (default $GOARCH)")
+
+// Tags are the build tags used when evaluating build constraints
+var Tags = flag.String("tags", "", "a comma-separated list of build tags used to evaluate build constraints")
+
+// Burst is the number of packages changing at once above which a single
+// change is emitted for all of them
+var Burst = flag.Int(
+	"burst",
+	20,
+	"treat changes to more than this many packages at once as a single change (0 disables)",
+)
+
+// PauseForGit waits for git checkouts, merges and rebases to finish before
+// emitting changes
+var PauseForGit = flag.Bool(
+	"pause-for-git",
+	true,
+	"wait for git checkouts, merges and rebases to finish, then emit a single change",
+)
+
+// Root adds directories to watch in addition to the current directory
+var Root = newPatterns(
+	"root",
+	"also watch `dir`, may be repeated",
+)
+
+// FollowSymlinks watches the directories that symlinks within the watched
+// directories point to
+var FollowSymlinks = flag.Bool(
+	"follow-symlinks",
+	false,
+	"follow symlinks to directories, watching their targets",
+)
+
+// GitIgnore skips the files and directories ignored by git
+var GitIgnore = flag.Bool(
+	"gitignore",
+	false,
+	"don't watch files and directories ignored by .gitignore files or .git/info/exclude",
+)
+
+// DebounceMode selects the debounce mode, see pkgwatch.DebounceMode
+var DebounceMode = pkgwatch.TrailingDebounce
+
+// MaxWait bounds how long changes may be delayed by a continuous stream of
+// events
+var MaxWait = flag.Duration(
+	"max-wait",
+	0,
+	"emit changes at least this often while events keep arriving (0 waits indefinitely)",
+)
+
+func init() {
+	flag.Var(
+		&DebounceMode,
+		"debounce-mode",
+		"'trailing' to run once changes stop, or 'leading' to also run as soon as the first change arrives",
+	)
+}
+
+// Include adds file patterns to watch in addition to go files
+var Include = newPatterns(
+	"include",
+	"also watch files matching `pattern` (e.g. '*.tmpl'), may be repeated",
+)
+
+// Exclude ignores changes to files matching a pattern
+var Exclude = newPatterns(
+	"exclude",
+	"ignore changes to files matching `pattern` (e.g. '*_gen.go'), may be repeated",
+)
+
+// IncludeDir watches directories that would otherwise be skipped, such as
+// vendor
+var IncludeDir = newPatterns(
+	"include-dir",
+	"watch directories matching `pattern` even if excluded (e.g. 'vendor'), may be repeated",
+)
+
+// ExcludeDir skips directories matching a pattern in addition to hidden and
+// vendor directories
+var ExcludeDir = newPatterns(
+	"exclude-dir",
+	"don't watch directories matching `pattern` (e.g. 'node_modules'), may be repeated",
+)
+
+// patterns is a flag.Value that collects each use of a repeated flag
+type patterns []string
+
+func newPatterns(name, usage string) *patterns {
+	p := &patterns{}
+	flag.Var(p, name, usage)
+	return p
+}
+
+func (p *patterns) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// NewWatcher returns a package watcher for dir configured using the common
+// flags.
+func NewWatcher(dir string, debounce time.Duration) *pkgwatch.Watcher {
+	var ctx *build.Context
+	if *Constraints {
+		var tags []string
+		for _, tag := range strings.Split(*Tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		ctx = pkgwatch.NewBuildContext(*GOOS, *GOARCH, tags)
+	}
+
+	return &pkgwatch.Watcher{
+		Dir:          dir,
+		Debounce:     debounce,
+		IsGB:         *IsGB,
+		PollInterval: *Poll,
+
+		SkipUnchanged:    *SkipUnchanged || *IgnoreFormatting,
+		IgnoreFormatting: *IgnoreFormatting,
+
+		IncludeFiles: append(pkgwatch.DefaultIncludeFiles, *Include...),
+		ExcludeFiles: *Exclude,
+		IncludeDirs:  *IncludeDir,
+		ExcludeDirs:  append(pkgwatch.DefaultExcludeDirs, *ExcludeDir...),
+
+		Build: ctx,
+
+		Roots:          *Root,
+		FollowSymlinks: *FollowSymlinks,
+		GitIgnore:      *GitIgnore,
+		DebounceMode:   DebounceMode,
+		MaxWait:        *MaxWait,
+		BurstThreshold: *Burst,
+		PauseForGit:    *PauseForGit,
+	}
+}
@@ -7,7 +7,17 @@ package main
 // - debounces executions by a configurable duration to allow for things like
 //   gofmt to run prior to kicking the command off.  This is the `debounce` flag
 // - provides a configurable cooldown for command executions to provide a
-//   maximum rate of churn.
+//   maximum rate of churn.  A package that changes during its cooldown is
+//   executed once the cooldown expires.
+// - runs at most `parallel` commands at once (by default, one per CPU), queueing
+//   the remaining packages in the order they changed.
+// - optionally (using `-policy cancel`) kills a package's running command when
+//   the package changes again, rather than letting it complete before rerunning.
+// - optionally (using the `dependents` flag) executes the command for every
+//   package that imports a changed package, directly or transitively.
+// - executes the command for packages that change together in dependency
+//   order, and optionally (using the `skip-blocked` flag) skips the packages
+//   whose dependencies just failed, reporting them as blocked.
 //
 // This tool was designed to support a TDD-based development workflow that
 // tests and re-installs a package everytime it is changed.  To do this, you would
@@ -15,16 +25,51 @@ package main
 //
 // 		mcdev-each-change bash -c "go test {{.Pkg}} && go install {{.Pkg}}"
 //
+// Besides {{.Pkg}}, the command's templates may reference the other fields of
+// the pkgwatch.Change that triggered the execution, e.g. {{.Dir}},
+// {{join .Files " "}} or {{.Ops}}, which renders as e.g. "create|write".
+// {{.Pkgs}} expands to one argument per changed package, or within a larger
+// argument, such as a `bash -c` script, to the packages separated by spaces.
+//
+// With the `batch` flag, all the packages that change within one debounce
+// window are passed to a single execution of the command, so that go can build
+// and test them in parallel:
+//
+// 		mcdev-each-change -batch go test {{.Pkgs}}
+//
+// When a module's go.mod or go.sum changes, the command is executed once for
+// the whole module with {{.Pkg}} set to the pattern matching all of its
+// packages, e.g. "example.com/mod/...".  To run a different command instead,
+// provide its template using the `module-cmd` flag, in which {{.Module}} is the
+// path of the changed module:
+//
+// 		mcdev-each-change -module-cmd "go mod verify && go test {{.Module}}/..." go test {{.Pkg}}
+//
+// The module command is run using `sh -c`.
+//
+// When a package is removed, the command is not executed.  To run a command
+// instead, provide its template using the `removed-cmd` flag; it is run using
+// `sh -c`.  When a package is moved, the command is executed for its new import
+// path, and {{.OldPkg}} holds the old one.
+//
+// When many packages change at once, such as when switching git branches, the
+// command is executed once with {{.Pkg}} set to a pattern matching all of them
+// and {{.Pkgs}} listing each of them.  See the `burst` and `pause-for-git`
+// flags.
+//
 // The command will run until interupted using ctrl+c
 //
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
@@ -39,13 +84,29 @@ import (
 var done = make(chan os.Signal, 1)
 
 var cmd *cmdtmpl.Command
+var moduleCmd *cmdtmpl.Command
+var removedCmd *cmdtmpl.Command
+
+// latest holds the changes seen for each work key since its command was last
+// executed, providing the template context when it next is.
+var latest = map[string]pkgwatch.Change{}
+var latestLock sync.Mutex
 
 var debounce = flag.Duration("debounce", 500*time.Millisecond, "how long to debounce package changes")
 var cooldown = flag.Duration("cooldown", 4*time.Second, "how long to cooldown each command execution")
+var parallel = flag.Int("parallel", runtime.NumCPU(), "how many command executions may run at once (0 is unlimited)")
+var policy pkgwork.Policy
+var order = flag.Bool("order", true, "execute the command for packages that change together in dependency order")
+var skipBlocked = flag.Bool("skip-blocked", false, "skip packages whose dependencies just failed (implies -order)")
+var batch = flag.Bool("batch", false, "execute the command once for all the packages changed within one debounce window (implies -parallel 1)")
+var dependents = flag.Bool("dependents", false, "also execute the command for packages that import a changed package")
+var moduleTmpl = flag.String("module-cmd", "", "the command to execute, using sh -c, when a module's go.mod or go.sum changes")
+var removedTmpl = flag.String("removed-cmd", "", "the command to execute, using sh -c, when a package is removed (by default, nothing is executed)")
 
 func main() {
 	var err error
 
+	flag.Var(&policy, "policy", "what to do when a package changes while its command is running: queue or cancel")
 	flag.Parse()
 	dotenv.Load()
 	signal.Notify(done, os.Interrupt, os.Kill)
@@ -56,47 +117,163 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if *moduleTmpl != "" {
+		moduleCmd, err = cmdtmpl.NewCommand([]string{"sh", "-c", *moduleTmpl})
+		if err != nil {
+			log.Println("error when parsing module command")
+			log.Fatal(err)
+		}
+	}
+
+	if *removedTmpl != "" {
+		removedCmd, err = cmdtmpl.NewCommand([]string{"sh", "-c", *removedTmpl})
+		if err != nil {
+			log.Println("error when parsing removed command")
+			log.Fatal(err)
+		}
+	}
+
 	dir, err := os.Getwd()
 	if err != nil {
 		log.Println("error when getting working directory")
 		log.Fatal(err)
 	}
 
-	watcher := &pkgwatch.Watcher{
-		Dir:      dir,
-		Debounce: *debounce,
-		IsGB:     *c.IsGB,
-	}
+	watcher := c.NewWatcher(dir, *debounce)
+	watcher.Dependents = *dependents
+	watcher.TrackImports = *order || *skipBlocked
+	watcher.Batch = *batch
 
 	worker := &pkgwork.Worker{
-		Fn:       execute,
-		Cooldown: *cooldown,
+		Fn:          execute,
+		Cooldown:    *cooldown,
+		MaxParallel: *parallel,
+		Policy:      policy,
 	}
-	if err := watcher.Run(); err != nil {
+	if *batch {
+		// batches often share packages, so one at a time is as fast as it gets
+		worker.MaxParallel = 1
+	}
+	if err := watcher.Init(); err != nil {
 		log.Println("error when starting watcher")
 		log.Fatal(err)
 	}
-	defer watcher.Close()
+
+	if watcher.TrackImports {
+		worker.Dependencies = watcher.Graph().Dependencies
+	}
+	if *skipBlocked {
+		worker.Blocked = blocked
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		if err := watcher.Run(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		if err := worker.Run(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}()
 
 	log.Println("waiting for changes")
 
 	for {
 		select {
-		case pkg := <-watcher.Changes():
-			go func() {
-				if err := worker.Run(pkg); err != nil {
-					log.Fatal(err)
-				}
-			}()
+		case change := <-watcher.Events():
+			key := workKey(change)
+			record(key, change)
+			worker.Push(key)
+		case err := <-watcher.Errors():
+			if !pkgwatch.IsTransient(err) {
+				log.Fatal(err)
+			}
+			log.Printf("warn: %v", err)
 		case _ = <-done:
 			log.Println("shutting down")
-			os.Exit(0)
+			cancel()
+			wg.Wait()
+			return
 		}
 	}
 }
 
-func execute(pkg string) error {
-	err := cmd.Run(struct{ Pkg string }{pkg})
+// workKey returns the key that change is pushed to the worker with.  Module
+// changes are kept apart from batches of the module's packages, whose pattern
+// may be the same.
+func workKey(change pkgwatch.Change) string {
+	if change.Kind == pkgwatch.ModuleChanged {
+		return "module " + change.Module
+	}
+	return change.Pkg
+}
+
+// record merges change into the pending change for key, if it has one of the
+// same kind, so that nothing is lost when a key is pushed again before its
+// command is executed.  Otherwise, change replaces it.
+func record(key string, change pkgwatch.Change) {
+	latestLock.Lock()
+	defer latestLock.Unlock()
+
+	if pending, ok := latest[key]; ok && pending.Kind == change.Kind {
+		pending.Merge(&change)
+		change = pending
+	}
+	latest[key] = change
+}
+
+// requeue returns the change of a cancelled execution to key's pending
+// changes, so that the next execution covers it too.  A change recorded while
+// the command ran is newer, so its kind wins and the cancelled change's files
+// are merged into it.
+func requeue(key string, change pkgwatch.Change) {
+	latestLock.Lock()
+	defer latestLock.Unlock()
+
+	if pending, ok := latest[key]; ok {
+		pending.Merge(&change)
+		change = pending
+	}
+	latest[key] = change
+}
+
+func execute(ctx context.Context, key string) error {
+	latestLock.Lock()
+	change, ok := latest[key]
+	delete(latest, key)
+	latestLock.Unlock()
+
+	if !ok {
+		return nil
+	}
+	pkg := change.Pkg
+
+	run := cmd
+	switch {
+	case change.Kind == pkgwatch.ModuleChanged && moduleCmd != nil:
+		run = moduleCmd
+	case change.Kind == pkgwatch.PackageRemoved && removedCmd == nil:
+		color.Yellow("REMOVED: %s", pkg)
+		return nil
+	case change.Kind == pkgwatch.PackageRemoved:
+		run = removedCmd
+	}
+
+	err := run.RunContext(ctx, newTemplateData(change))
+	if ctx.Err() != nil {
+		requeue(key, change)
+		color.Yellow("CANCELLED: %s", pkg)
+		return nil
+	}
+
 	if err == nil {
 		color.Green("GOOD: %s", pkg)
 		return nil
@@ -109,5 +286,26 @@ func execute(pkg string) error {
 
 	color.Red("FAIL: %s", pkg)
 	fmt.Println(eerr)
-	return nil
+	return pkgwork.ErrFailed
+}
+
+func blocked(pkg, by string) {
+	color.Yellow("BLOCKED: %s is blocked by %s", pkg, by)
+}
+
+// templateData is the context the command templates are rendered against
+type templateData struct {
+	pkgwatch.Change
+
+	// Pkgs shadows Change.Pkgs, so that it is rendered as an argument per
+	// package, see cmdtmpl.List
+	Pkgs cmdtmpl.List
+}
+
+func newTemplateData(change pkgwatch.Change) templateData {
+	pkgs := change.Pkgs
+	if len(pkgs) == 0 {
+		pkgs = []string{change.Pkg}
+	}
+	return templateData{Change: change, Pkgs: pkgs}
 }
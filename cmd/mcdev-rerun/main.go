@@ -4,6 +4,7 @@ package main
 //
 // - starts the command provided
 // - watches for .go files being changed underneath the current directory (recursively)
+// - also restarts the command when a module's go.mod or go.sum changes
 // - debounces restarts by a configurable duration to allow for things like
 //   gofmt to run prior to restarting the service.  This is the `debounce` flag
 // - restarts the command provided anytime it exits
@@ -20,6 +21,7 @@ package main
 //
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
@@ -67,26 +69,43 @@ func main() {
 		log.Fatal(err)
 	}
 
-	watcher := &pkgwatch.Watcher{
-		Dir:      dir,
-		Debounce: *debounce,
-		IsGB:     *c.IsGB,
-	}
+	watcher := c.NewWatcher(dir, *debounce)
 
-	if err := watcher.Run(); err != nil {
+	if err := watcher.Init(); err != nil {
 		log.Fatal(err)
 	}
-	defer watcher.Close()
 
-	proc.Start()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		if err := watcher.Run(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		if err := proc.Run(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}()
 
 	for {
 		select {
 		case <-watcher.Changes():
 			proc.Restart()
+		case err := <-watcher.Errors():
+			if !pkgwatch.IsTransient(err) {
+				log.Fatal(err)
+			}
+			log.Printf("warn: %v", err)
 		case <-sigs:
-			proc.Shutdown()
-			os.Exit(0)
+			cancel()
+			wg.Wait()
+			return
 		}
 	}
 }
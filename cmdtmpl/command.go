@@ -3,14 +3,60 @@ package cmdtmpl
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"os"
 	"os/exec"
+	"strings"
 	"text/template"
 )
 
 var ErrInvalidCommand = errors.New("invalid command")
 
+// funcs are the functions available to every command template, in addition to
+// text/template's builtins
+var funcs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// List is a list of values that a command template renders as one argument
+// per value when the list is the whole argument, e.g. `go test {{.Pkgs}}` runs
+// `go test a b` for a List of "a" and "b".  Within a larger argument, such as
+// the script of `sh -c "go test {{.Pkgs}}"`, the values are separated by
+// spaces instead.
+type List []string
+
+// String delimits the list and its values with control characters, which
+// can't otherwise appear in an argument, for Make to expand.
+func (l List) String() string {
+	return listStart + strings.Join(l, listSep) + listEnd
+}
+
+const (
+	listStart = "\x02"
+	listSep   = "\x00"
+	listEnd   = "\x03"
+)
+
+// spaceLists renders the lists within an argument separated by spaces
+var spaceLists = strings.NewReplacer(listStart, "", listSep, " ", listEnd, "")
+
+// expand returns the arguments that a rendered argument stands for
+func expand(arg string) []string {
+	whole := strings.HasPrefix(arg, listStart) &&
+		strings.HasSuffix(arg, listEnd) &&
+		strings.Count(arg, listStart) == 1
+	if !whole {
+		return []string{spaceLists.Replace(arg)}
+	}
+
+	values := arg[len(listStart) : len(arg)-len(listEnd)]
+	if values == "" {
+		return nil
+	}
+	return strings.Split(values, listSep)
+}
+
 type Command struct {
 	Cmd  string
 	Args []*template.Template
@@ -27,7 +73,7 @@ func NewCommand(args []string) (*Command, error) {
 	result.Args = make([]*template.Template, len(args)-1)
 
 	for i, arg := range args[1:] {
-		t, err := template.New("arg").Parse(arg)
+		t, err := template.New("arg").Funcs(funcs).Parse(arg)
 		if err != nil {
 			return nil, err
 		}
@@ -37,15 +83,15 @@ func NewCommand(args []string) (*Command, error) {
 }
 
 func (cmd *Command) Make(ctx interface{}) (*exec.Cmd, error) {
-	args := make([]string, len(cmd.Args))
+	args := make([]string, 0, len(cmd.Args))
 
-	for i, t := range cmd.Args {
+	for _, t := range cmd.Args {
 		var buf bytes.Buffer
 		err := t.Execute(&buf, ctx)
 		if err != nil {
 			return nil, err
 		}
-		args[i] = buf.String()
+		args = append(args, expand(buf.String())...)
 	}
 
 	proc := exec.Command(cmd.Cmd, args...)
@@ -55,9 +101,35 @@ func (cmd *Command) Make(ctx interface{}) (*exec.Cmd, error) {
 }
 
 func (cmd *Command) Run(ctx interface{}) error {
-	proc, err := cmd.Make(ctx)
+	return cmd.RunContext(context.Background(), ctx)
+}
+
+// RunContext runs the command rendered using data, killing it along with any
+// processes it started should ctx be cancelled before it exits, in which case
+// ctx's error is returned.
+func (cmd *Command) RunContext(ctx context.Context, data interface{}) error {
+	proc, err := cmd.Make(data)
 	if err != nil {
 		return err
 	}
-	return proc.Run()
+
+	setProcessGroup(proc)
+	err = proc.Start()
+	if err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- proc.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		return err
+	case <-ctx.Done():
+		killProcessGroup(proc)
+		<-exited
+		return ctx.Err()
+	}
 }
@@ -1,6 +1,9 @@
 package cmdtmpl_test
 
 import (
+	"context"
+	"time"
+
 	. "github.com/nullstyle/mcdev/cmdtmpl"
 
 	. "github.com/onsi/ginkgo"
@@ -59,3 +62,84 @@ var _ = Describe("cmdtmpl.NewCommand", func() {
 		})
 	})
 })
+
+var _ = Describe("cmdtmpl.Command.Make", func() {
+	It("renders each argument against the provided context", func() {
+		cmd, err := NewCommand([]string{"echo", "{{.Pkg}}", "{{join .Files \",\"}}"})
+		Expect(err).To(BeNil())
+
+		proc, err := cmd.Make(struct {
+			Pkg   string
+			Files []string
+		}{"example.com/pkg", []string{"a.go", "b.go"}})
+		Expect(err).To(BeNil())
+		Expect(proc.Args).To(Equal([]string{"echo", "example.com/pkg", "a.go,b.go"}))
+	})
+
+	It("renders a List as an argument per value", func() {
+		cmd, err := NewCommand([]string{"go", "test", "{{.Pkgs}}", "-run={{.Run}}"})
+		Expect(err).To(BeNil())
+
+		proc, err := cmd.Make(struct {
+			Pkgs List
+			Run  string
+		}{List{"example.com/a", "example.com/b"}, "TestA"})
+		Expect(err).To(BeNil())
+		Expect(proc.Args).To(Equal([]string{"go", "test", "example.com/a", "example.com/b", "-run=TestA"}))
+	})
+
+	It("separates a List by spaces within a larger argument", func() {
+		cmd, err := NewCommand([]string{"sh", "-c", "go test {{.Pkgs}} && go vet {{.Pkgs}}"})
+		Expect(err).To(BeNil())
+
+		proc, err := cmd.Make(struct{ Pkgs List }{List{"a", "b"}})
+		Expect(err).To(BeNil())
+		Expect(proc.Args).To(Equal([]string{"sh", "-c", "go test a b && go vet a b"}))
+	})
+
+	It("passes every value of a List to a shell script", func() {
+		cmd, err := NewCommand([]string{"sh", "-c", `test "$(echo {{.Pkgs}})" = "a b c"`})
+		Expect(err).To(BeNil())
+		Expect(cmd.Run(struct{ Pkgs List }{List{"a", "b", "c"}})).To(Succeed())
+	})
+
+	It("renders an empty List as no arguments", func() {
+		cmd, err := NewCommand([]string{"echo", "{{.Pkgs}}"})
+		Expect(err).To(BeNil())
+
+		proc, err := cmd.Make(struct{ Pkgs List }{})
+		Expect(err).To(BeNil())
+		Expect(proc.Args).To(Equal([]string{"echo"}))
+	})
+
+	It("allows joining a List", func() {
+		cmd, err := NewCommand([]string{"echo", "{{join .Pkgs \" \"}}"})
+		Expect(err).To(BeNil())
+
+		proc, err := cmd.Make(struct{ Pkgs List }{List{"a", "b"}})
+		Expect(err).To(BeNil())
+		Expect(proc.Args).To(Equal([]string{"echo", "a b"}))
+	})
+})
+
+var _ = Describe("cmdtmpl.Command.RunContext", func() {
+	It("returns the command's result once it exits", func() {
+		cmd, err := NewCommand([]string{"sh", "-c", "exit {{.}}"})
+		Expect(err).To(BeNil())
+
+		Expect(cmd.RunContext(context.Background(), 0)).To(Succeed())
+		Expect(cmd.RunContext(context.Background(), 1)).NotTo(Succeed())
+	})
+
+	It("kills the command and its children when ctx is cancelled", func() {
+		cmd, err := NewCommand([]string{"sh", "-c", "sleep 10 & wait"})
+		Expect(err).To(BeNil())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		Expect(cmd.RunContext(ctx, nil)).To(Equal(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+	})
+})
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package cmdtmpl
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts proc in a process group of its own, so that it can be
+// killed along with its children
+func setProcessGroup(proc *exec.Cmd) {
+	proc.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills proc's process group
+func killProcessGroup(proc *exec.Cmd) {
+	syscall.Kill(-proc.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package cmdtmpl
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on windows
+func setProcessGroup(proc *exec.Cmd) {}
+
+// killProcessGroup kills proc.  On windows, the processes it started are left
+// running.
+func killProcessGroup(proc *exec.Cmd) {
+	proc.Process.Kill()
+}
@@ -0,0 +1,7 @@
+// Package gitignore matches paths against the patterns of .gitignore files, so
+// that mcdev's tools can skip the files git itself ignores.
+//
+// The patterns of every .gitignore file between a repository's root and a
+// path apply to it, along with those of the repository's .git/info/exclude.
+// Global excludes configured using git's core.excludesFile are not consulted.
+package gitignore
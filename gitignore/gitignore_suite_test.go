@@ -0,0 +1,13 @@
+package gitignore_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestGitignore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Gitignore Suite")
+}
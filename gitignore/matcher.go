@@ -0,0 +1,153 @@
+package gitignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Matcher matches paths within a repository against its ignore files.  The
+// ignore files are read as they are needed and cached; call Invalidate when one
+// changes.
+type Matcher struct {
+	// Root is the root directory of the repository
+	Root string
+
+	exclude string
+
+	lock  sync.Mutex
+	files map[string][]pattern
+}
+
+// New returns a Matcher for the repository containing dir.  If dir isn't
+// within a git repository, only .gitignore files in dir and its descendants
+// are consulted.
+func New(dir string) *Matcher {
+	root, gitDir, found := FindRepository(dir)
+	if !found {
+		root = dir
+	}
+
+	m := &Matcher{
+		Root:  root,
+		files: map[string][]pattern{},
+	}
+	if gitDir != "" {
+		m.exclude = filepath.Join(gitDir, "info", "exclude")
+	}
+	return m
+}
+
+// Match returns true if path, which is a directory if isDir is true, is ignored
+// by git.  A path is also ignored if any of its parent directories are, in
+// which case git doesn't allow the path to be re-included by a negated pattern.
+func (m *Matcher) Match(path string, isDir bool) bool {
+	rel, ok := m.rel(path)
+	if !ok || rel == "." {
+		return false
+	}
+
+	elems := strings.Split(rel, "/")
+	for i := 1; i < len(elems); i++ {
+		if m.matchOnly(elems[:i], true) {
+			return true
+		}
+	}
+	return m.matchOnly(elems, isDir)
+}
+
+// Invalidate forgets the cached patterns of the ignore file in dir, which has
+// changed
+func (m *Matcher) Invalidate(dir string) {
+	m.lock.Lock()
+	delete(m.files, dir)
+	m.lock.Unlock()
+}
+
+// matchOnly matches the path with the provided elements, relative to the root,
+// without considering its parents.  The patterns of deeper ignore files take
+// precedence, and within a file the last matching pattern wins.
+func (m *Matcher) matchOnly(elems []string, isDir bool) bool {
+	ignored := false
+
+	check := func(patterns []pattern, rel string) {
+		for _, p := range patterns {
+			if p.match(rel, isDir) {
+				ignored = !p.negate
+			}
+		}
+	}
+
+	if m.exclude != "" {
+		check(m.patterns(m.exclude), strings.Join(elems, "/"))
+	}
+
+	dir := m.Root
+	for i := range elems {
+		check(m.patterns(filepath.Join(dir, ".gitignore")), strings.Join(elems[i:], "/"))
+		dir = filepath.Join(dir, elems[i])
+	}
+	return ignored
+}
+
+// patterns returns the patterns of the provided ignore file, reading it if it
+// isn't cached.  Missing files have no patterns.
+func (m *Matcher) patterns(file string) []pattern {
+	dir := filepath.Dir(file)
+	if file == m.exclude {
+		dir = file
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if patterns, ok := m.files[dir]; ok {
+		return patterns
+	}
+
+	data, _ := ioutil.ReadFile(file)
+	patterns := parsePatterns(data)
+	m.files[dir] = patterns
+	return patterns
+}
+
+// rel returns the slash separated path of path relative to the root
+func (m *Matcher) rel(path string) (string, bool) {
+	rel, err := filepath.Rel(m.Root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// FindRepository searches dir and its parents for a git repository, returning
+// the root of its working tree and its git directory: either a .git directory,
+// or the directory named by a .git file as used by worktrees and submodules.
+func FindRepository(dir string) (root, gitDir string, found bool) {
+	for current := dir; ; {
+		candidate := filepath.Join(current, ".git")
+		stat, err := os.Stat(candidate)
+		if err == nil && stat.IsDir() {
+			return current, candidate, true
+		}
+
+		if err == nil {
+			data, err := ioutil.ReadFile(candidate)
+			if err == nil && strings.HasPrefix(string(data), "gitdir:") {
+				gitDir := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(current, gitDir)
+				}
+				return current, gitDir, true
+			}
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", "", false
+		}
+		current = parent
+	}
+}
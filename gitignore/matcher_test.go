@@ -0,0 +1,118 @@
+package gitignore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/nullstyle/mcdev/gitignore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("gitignore.Matcher", func() {
+	var (
+		dir     string
+		subject *Matcher
+	)
+
+	path := func(rel string) string {
+		return filepath.Join(dir, filepath.FromSlash(rel))
+	}
+
+	write := func(rel, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(path(rel)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path(rel), []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-gitignore")
+		Expect(err).To(BeNil())
+		dir, err = filepath.EvalSymlinks(dir)
+		Expect(err).To(BeNil())
+
+		Expect(os.MkdirAll(path(".git/info"), 0755)).To(Succeed())
+		write(".gitignore", "# build output\n/bin/\nnode_modules\n*.out\n!keep.out\ncoverage/**\ndocs/**/*.html\n")
+		write("web/.gitignore", "dist/\n!node_modules\n")
+		write(".git/info/exclude", "scratch.go\n")
+	})
+
+	JustBeforeEach(func() {
+		subject = New(path("web"))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("finds the repository root", func() {
+		Expect(subject.Root).To(Equal(dir))
+	})
+
+	It("matches names at any depth", func() {
+		Expect(subject.Match(path("node_modules"), true)).To(BeTrue())
+		Expect(subject.Match(path("api/cover.out"), false)).To(BeTrue())
+		Expect(subject.Match(path("api/api.go"), false)).To(BeFalse())
+	})
+
+	It("anchors patterns containing a slash", func() {
+		Expect(subject.Match(path("bin"), true)).To(BeTrue())
+		Expect(subject.Match(path("cmd/bin"), true)).To(BeFalse())
+	})
+
+	It("matches directory-only patterns against directories", func() {
+		Expect(subject.Match(path("bin"), false)).To(BeFalse())
+		Expect(subject.Match(path("web/dist"), true)).To(BeTrue())
+	})
+
+	It("matches the contents of ignored directories", func() {
+		Expect(subject.Match(path("bin/server"), false)).To(BeTrue())
+		Expect(subject.Match(path("web/dist/app.js"), false)).To(BeTrue())
+	})
+
+	It("supports double stars", func() {
+		Expect(subject.Match(path("coverage/html/index.html"), false)).To(BeTrue())
+		Expect(subject.Match(path("coverage"), true)).To(BeFalse())
+		Expect(subject.Match(path("docs/index.html"), false)).To(BeTrue())
+		Expect(subject.Match(path("docs/api/v1/index.html"), false)).To(BeTrue())
+	})
+
+	It("supports negation", func() {
+		Expect(subject.Match(path("keep.out"), false)).To(BeFalse())
+	})
+
+	It("lets nested files override their parents", func() {
+		Expect(subject.Match(path("web/node_modules"), true)).To(BeFalse())
+	})
+
+	It("reads .git/info/exclude", func() {
+		Expect(subject.Match(path("api/scratch.go"), false)).To(BeTrue())
+	})
+
+	It("ignores paths outside of the repository", func() {
+		Expect(subject.Match(filepath.Dir(dir), true)).To(BeFalse())
+	})
+
+	It("rereads invalidated files", func() {
+		Expect(subject.Match(path("api/api.go"), false)).To(BeFalse())
+
+		write("api/.gitignore", "api.go\n")
+		Expect(subject.Match(path("api/api.go"), false)).To(BeFalse())
+
+		subject.Invalidate(path("api"))
+		Expect(subject.Match(path("api/api.go"), false)).To(BeTrue())
+	})
+
+	Context("outside of a repository", func() {
+		BeforeEach(func() {
+			Expect(os.RemoveAll(path(".git"))).To(Succeed())
+		})
+
+		It("uses the provided directory as the root", func() {
+			Expect(subject.Root).To(Equal(path("web")))
+			Expect(subject.Match(path("web/dist"), true)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,116 @@
+package gitignore
+
+import (
+	"path"
+	"strings"
+)
+
+// pattern is a single line of a .gitignore file
+type pattern struct {
+	// segments are the slash separated elements of the pattern, relative to
+	// the directory containing the .gitignore file.  A "**" segment matches
+	// any number of elements.
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// parsePatterns parses the contents of a .gitignore file
+func parsePatterns(data []byte) []pattern {
+	var result []pattern
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if p, ok := parsePattern(line); ok {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// parsePattern parses a single line of a .gitignore file, returning false for
+// blank lines and comments.
+func parsePattern(line string) (pattern, bool) {
+	var p pattern
+
+	line = trimTrailingSpace(line)
+	if line == "" || line[0] == '#' {
+		return p, false
+	}
+
+	if line[0] == '!' {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return p, false
+	}
+
+	// a pattern without a slash matches at any depth, otherwise it is
+	// relative to the .gitignore's directory
+	if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	line = strings.TrimPrefix(line, "/")
+
+	p.segments = strings.Split(line, "/")
+	return p, true
+}
+
+// trimTrailingSpace removes trailing spaces, unless they are escaped with a
+// backslash
+func trimTrailingSpace(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// match returns true if the pattern matches rel, the slash separated path of a
+// file relative to the directory containing the .gitignore file.
+func (p pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches the elements of a path against the segments of a
+// pattern
+func matchSegments(segments, elems []string) bool {
+	for len(segments) > 0 {
+		if segments[0] == "**" {
+			// "**" matches zero or more elements, except that a trailing "**"
+			// matches everything inside, but not the directory itself
+			if len(segments) == 1 {
+				return len(elems) > 0
+			}
+
+			for i := 0; i <= len(elems); i++ {
+				if matchSegments(segments[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(elems) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(segments[0], elems[0]); !ok {
+			return false
+		}
+		segments, elems = segments[1:], elems[1:]
+	}
+
+	return len(elems) == 0
+}
@@ -0,0 +1,8 @@
+// Package gomod provides just enough understanding of go.mod and go.work files
+// for mcdev's tools to map directories onto import paths when working outside
+// of a GOPATH.
+//
+// It is intentionally not a complete implementation of the go.mod grammar:
+// only the directives mcdev cares about are interpreted, and the rest are
+// ignored.
+package gomod
@@ -0,0 +1,13 @@
+package gomod_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestGomod(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Gomod Suite")
+}
@@ -0,0 +1,127 @@
+package gomod
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when no go.mod file could be found
+var ErrNotFound = errors.New("go.mod not found")
+
+// Module represents a go module: a directory containing a go.mod file
+type Module struct {
+	// Dir is the absolute path of the directory that contains the go.mod file
+	Dir string
+	// Path is the module path, as declared by the go.mod's module directive
+	Path string
+	// Replaces holds the go.mod's replace directives
+	Replaces []Replace
+}
+
+// Replace represents a replace directive, e.g. `replace example.com/a v1.0.0
+// => ../a`.  Versions are empty when not specified.
+type Replace struct {
+	Old, OldVersion string
+	New, NewVersion string
+}
+
+// IsLocal returns true if the replacement is a directory rather than a module,
+// i.e. its path is absolute or begins with ./ or ../
+func (r Replace) IsLocal() bool {
+	return filepath.IsAbs(r.New) ||
+		strings.HasPrefix(r.New, "./") || strings.HasPrefix(r.New, "../") ||
+		r.New == "." || r.New == ".."
+}
+
+// LocalReplaces returns the absolute paths of the directories named by the
+// module's local replace directives
+func (m *Module) LocalReplaces() []string {
+	var result []string
+	for _, r := range m.Replaces {
+		if !r.IsLocal() {
+			continue
+		}
+
+		dir := filepath.FromSlash(r.New)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(m.Dir, dir)
+		}
+		result = append(result, filepath.Clean(dir))
+	}
+	return result
+}
+
+// Find searches dir and each of its parents for a go.mod file, loading the
+// first one found.  ErrNotFound is returned if the filesystem root is reached
+// without finding one.
+func Find(dir string) (*Module, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		_, err := os.Stat(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			return Load(dir)
+		}
+
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+// Load reads the go.mod file in dir
+func Load(dir string) (*Module, error) {
+	file := filepath.Join(dir, "go.mod")
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Module{Dir: dir}
+	for _, d := range parseDirectives(data) {
+		switch {
+		case d.Verb == "module" && len(d.Args) > 0:
+			result.Path = d.Args[0]
+		case d.Verb == "replace":
+			if r, ok := parseReplace(d.Args); ok {
+				result.Replaces = append(result.Replaces, r)
+			}
+		}
+	}
+
+	if result.Path == "" {
+		return nil, fmt.Errorf("%s: missing module directive", file)
+	}
+
+	return result, nil
+}
+
+// ImportPath returns the import path of the package in dir, provided dir is
+// the module's directory or is underneath it.
+func (m *Module) ImportPath(dir string) (string, bool) {
+	rel, err := filepath.Rel(m.Dir, dir)
+	if err != nil {
+		return "", false
+	}
+
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return path.Join(m.Path, filepath.ToSlash(rel)), true
+}
@@ -0,0 +1,120 @@
+package gomod_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/nullstyle/mcdev/gomod"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("gomod.Find", func() {
+	var dir string
+
+	write := func(path, contents string) {
+		path = filepath.Join(dir, path)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-gomod")
+		Expect(err).To(BeNil())
+		dir, err = filepath.EvalSymlinks(dir)
+		Expect(err).To(BeNil())
+
+		write("go.mod", "// the root module\nmodule example.com/root // trailing\n\ngo 1.21\n")
+		write("nested/go.mod", "module \"example.com/nested\"\n")
+		write("nested/pkg/a.go", "package pkg")
+		write("broken/go.mod", "go 1.21\n")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("finds the go.mod in the provided directory", func() {
+		mod, err := Find(dir)
+		Expect(err).To(BeNil())
+		Expect(mod.Dir).To(Equal(dir))
+		Expect(mod.Path).To(Equal("example.com/root"))
+	})
+
+	It("finds the nearest go.mod of a parent directory", func() {
+		mod, err := Find(filepath.Join(dir, "nested", "pkg"))
+		Expect(err).To(BeNil())
+		Expect(mod.Dir).To(Equal(filepath.Join(dir, "nested")))
+		Expect(mod.Path).To(Equal("example.com/nested"))
+	})
+
+	It("returns an error when the go.mod has no module directive", func() {
+		_, err := Find(filepath.Join(dir, "broken"))
+		Expect(err).NotTo(BeNil())
+	})
+
+	Describe("replace directives", func() {
+		BeforeEach(func() {
+			write("go.mod", `module example.com/root
+
+replace example.com/a => ../a
+
+replace (
+	example.com/b v1.2.0 => ./libs/b
+	example.com/c => example.com/fork/c v1.0.1
+	example.com/d => /opt/d
+	broken
+)
+`)
+		})
+
+		It("parses them", func() {
+			mod, err := Find(dir)
+			Expect(err).To(BeNil())
+			Expect(mod.Replaces).To(Equal([]Replace{
+				{Old: "example.com/a", New: "../a"},
+				{Old: "example.com/b", OldVersion: "v1.2.0", New: "./libs/b"},
+				{Old: "example.com/c", New: "example.com/fork/c", NewVersion: "v1.0.1"},
+				{Old: "example.com/d", New: "/opt/d"},
+			}))
+		})
+
+		It("resolves the local replacement directories", func() {
+			mod, err := Find(dir)
+			Expect(err).To(BeNil())
+			Expect(mod.LocalReplaces()).To(Equal([]string{
+				filepath.Join(filepath.Dir(dir), "a"),
+				filepath.Join(dir, "libs", "b"),
+				"/opt/d",
+			}))
+		})
+	})
+
+	Describe("Module.ImportPath", func() {
+		var mod *Module
+
+		BeforeEach(func() {
+			mod = &Module{Dir: dir, Path: "example.com/root"}
+		})
+
+		It("returns the module path for the module directory", func() {
+			pkg, ok := mod.ImportPath(dir)
+			Expect(ok).To(BeTrue())
+			Expect(pkg).To(Equal("example.com/root"))
+		})
+
+		It("joins the relative path of sub-directories", func() {
+			pkg, ok := mod.ImportPath(filepath.Join(dir, "a", "b"))
+			Expect(ok).To(BeTrue())
+			Expect(pkg).To(Equal("example.com/root/a/b"))
+		})
+
+		It("rejects directories outside of the module", func() {
+			_, ok := mod.ImportPath(filepath.Dir(dir))
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,103 @@
+package gomod
+
+import (
+	"strconv"
+	"strings"
+)
+
+// directive represents a single line of a go.mod or go.work file, e.g. `module
+// github.com/nullstyle/mcdev`.  Directives declared inside of a block, such as
+// `require ( ... )`, are expanded to one directive per line, each carrying the
+// block's verb.
+type directive struct {
+	Verb string
+	Args []string
+}
+
+// parseDirectives splits the provided file contents into directives,
+// stripping comments and expanding blocks.
+func parseDirectives(data []byte) []directive {
+	var (
+		results []directive
+		block   string
+	)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			results = append(results, directive{block, unquoteAll(fields)})
+			continue
+		}
+
+		if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		results = append(results, directive{fields[0], unquoteAll(fields[1:])})
+	}
+
+	return results
+}
+
+// parseReplace parses the arguments of a replace directive, returning false if
+// they are malformed.
+func parseReplace(args []string) (Replace, bool) {
+	var r Replace
+
+	arrow := -1
+	for i, arg := range args {
+		if arg == "=>" {
+			arrow = i
+			break
+		}
+	}
+
+	old, replacement := args, []string(nil)
+	if arrow >= 0 {
+		old, replacement = args[:arrow], args[arrow+1:]
+	}
+
+	if len(old) < 1 || len(old) > 2 || len(replacement) < 1 || len(replacement) > 2 {
+		return r, false
+	}
+
+	r.Old = old[0]
+	if len(old) == 2 {
+		r.OldVersion = old[1]
+	}
+	r.New = replacement[0]
+	if len(replacement) == 2 {
+		r.NewVersion = replacement[1]
+	}
+	return r, true
+}
+
+// unquoteAll strips go string quoting from any of the provided fields that are
+// quoted.
+func unquoteAll(fields []string) []string {
+	result := make([]string, len(fields))
+	for i, f := range fields {
+		result[i] = f
+		if len(f) < 2 || (f[0] != '"' && f[0] != '`') {
+			continue
+		}
+
+		if uq, err := strconv.Unquote(f); err == nil {
+			result[i] = uq
+		}
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package gomod
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoWorkspace is returned when no go.work file could be found, or when
+// workspaces have been disabled by setting GOWORK=off.
+var ErrNoWorkspace = errors.New("go.work not found")
+
+// Workspace represents a multi-module workspace defined by a go.work file
+type Workspace struct {
+	// Dir is the absolute path of the directory that contains the go.work file
+	Dir string
+	// Uses holds the absolute path of every directory named by the go.work's
+	// use directives
+	Uses []string
+}
+
+// FindWorkspace searches dir and each of its parents for a go.work file,
+// loading the first one found.  Like the go command, the GOWORK environment
+// variable takes precedence over searching when it is set.
+func FindWorkspace(dir string) (*Workspace, error) {
+	switch gowork := os.Getenv("GOWORK"); gowork {
+	case "off":
+		return nil, ErrNoWorkspace
+	case "":
+		// search below
+	default:
+		return loadWorkspaceFile(gowork)
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		file := filepath.Join(dir, "go.work")
+		_, err := os.Stat(file)
+		if err == nil {
+			return loadWorkspaceFile(file)
+		}
+
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNoWorkspace
+		}
+		dir = parent
+	}
+}
+
+// LoadWorkspace reads the go.work file in dir
+func LoadWorkspace(dir string) (*Workspace, error) {
+	return loadWorkspaceFile(filepath.Join(dir, "go.work"))
+}
+
+// Modules loads the module of every directory used by the workspace
+func (ws *Workspace) Modules() ([]*Module, error) {
+	result := make([]*Module, 0, len(ws.Uses))
+	for _, dir := range ws.Uses {
+		mod, err := Load(dir)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, mod)
+	}
+	return result, nil
+}
+
+func loadWorkspaceFile(file string) (*Workspace, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Workspace{Dir: filepath.Dir(file)}
+	for _, d := range parseDirectives(data) {
+		if d.Verb != "use" || len(d.Args) == 0 {
+			continue
+		}
+
+		use := filepath.FromSlash(d.Args[0])
+		if !filepath.IsAbs(use) {
+			use = filepath.Join(result.Dir, use)
+		}
+		result.Uses = append(result.Uses, filepath.Clean(use))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package gomod_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/nullstyle/mcdev/gomod"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("gomod.FindWorkspace", func() {
+	var dir string
+
+	write := func(path, contents string) {
+		path = filepath.Join(dir, path)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-gowork")
+		Expect(err).To(BeNil())
+		dir, err = filepath.EvalSymlinks(dir)
+		Expect(err).To(BeNil())
+
+		write("go.work", "go 1.21\n\nuse ./api\nuse (\n\t./store // the store\n\t\"./lib\"\n)\n")
+		write("api/go.mod", "module example.com/api\n")
+		write("store/go.mod", "module example.com/store\n")
+		write("lib/go.mod", "module example.com/lib\n")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("finds the go.work of a parent directory", func() {
+		ws, err := FindWorkspace(filepath.Join(dir, "api"))
+		Expect(err).To(BeNil())
+		Expect(ws.Dir).To(Equal(dir))
+	})
+
+	It("resolves every use directive relative to the go.work", func() {
+		ws, err := LoadWorkspace(dir)
+		Expect(err).To(BeNil())
+		Expect(ws.Uses).To(Equal([]string{
+			filepath.Join(dir, "api"),
+			filepath.Join(dir, "store"),
+			filepath.Join(dir, "lib"),
+		}))
+	})
+
+	It("loads the module of every used directory", func() {
+		ws, err := LoadWorkspace(dir)
+		Expect(err).To(BeNil())
+
+		mods, err := ws.Modules()
+		Expect(err).To(BeNil())
+		Expect(mods).To(HaveLen(3))
+		Expect(mods[1].Path).To(Equal("example.com/store"))
+	})
+
+	Context("when GOWORK=off", func() {
+		BeforeEach(func() {
+			os.Setenv("GOWORK", "off")
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("GOWORK")
+		})
+
+		It("returns ErrNoWorkspace", func() {
+			_, err := FindWorkspace(dir)
+			Expect(err).To(Equal(ErrNoWorkspace))
+		})
+	})
+})
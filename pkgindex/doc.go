@@ -9,4 +9,8 @@
 // indexes.  Notably there is the GBIndex struct and the GoPathIndex struct which
 // wrap the other index types to provide an index over a gb project or the local
 // system's GOPATH, respectively.
+//
+// Module-based code is indexed by ModuleIndex, which derives import paths from a
+// go.mod file, and GoWorkIndex, which indexes every module used by a go.work
+// file.
 package pkgindex
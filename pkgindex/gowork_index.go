@@ -0,0 +1,39 @@
+package pkgindex
+
+import (
+	"github.com/nullstyle/mcdev/gomod"
+)
+
+// GoWorkIndex represents an index over every module of a go workspace, as
+// described by a go.work file found in Dir or one of its parents.
+type GoWorkIndex struct {
+	Dir string
+
+	idx *CompoundIndex
+}
+
+// Index locates the go.work file and indexes each module it uses.
+func (idx *GoWorkIndex) Index() error {
+	ws, err := gomod.FindWorkspace(idx.Dir)
+	if err != nil {
+		return err
+	}
+
+	idx.idx = &CompoundIndex{}
+	for _, dir := range ws.Uses {
+		idx.idx.Add(&ModuleIndex{Dir: dir})
+	}
+
+	return idx.idx.Index()
+}
+
+// RefreshIfNeeded calls through to the index of each module in the workspace.
+func (idx *GoWorkIndex) RefreshIfNeeded() error {
+	return idx.idx.RefreshIfNeeded()
+}
+
+// Search returns any packages that match the query in any of the workspace's
+// modules.
+func (idx *GoWorkIndex) Search(query string) (results []string, err error) {
+	return idx.idx.Search(query)
+}
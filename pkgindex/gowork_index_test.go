@@ -0,0 +1,63 @@
+package pkgindex
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GoWorkIndex", func() {
+	var subject *GoWorkIndex
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-gowork-index")
+		Expect(err).To(BeNil())
+
+		write := func(path, contents string) {
+			path = filepath.Join(dir, path)
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		}
+
+		write("go.work", "go 1.21\n\nuse (\n\t./api\n\t./store\n)\n")
+		write("api/go.mod", "module example.com/api\n")
+		write("api/main.go", "package main")
+		write("api/handlers/handlers.go", "package handlers")
+		write("api/testdata/fixture.go", "package fixture")
+		write("store/go.mod", "module example.com/store\n")
+		write("store/store.go", "package store")
+		write("store/.hidden/hidden.go", "package hidden")
+		write("store/plugin/go.mod", "module example.com/plugin\n")
+		write("store/plugin/plugin.go", "package plugin")
+
+		subject = &GoWorkIndex{Dir: filepath.Join(dir, "api")}
+		Expect(subject.Index()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Search", func() {
+		It("returns the packages of every module in the workspace", func() {
+			results, err := subject.Search("")
+			Expect(err).To(BeNil())
+			Expect(results).To(ConsistOf(
+				"example.com/api",
+				"example.com/api/handlers",
+				"example.com/store",
+			))
+		})
+
+		It("filters results using the query", func() {
+			results, err := subject.Search("store")
+			Expect(err).To(BeNil())
+			Expect(results).To(ConsistOf("example.com/store"))
+		})
+	})
+})
@@ -0,0 +1,86 @@
+package pkgindex
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/nullstyle/mcdev/gomod"
+)
+
+// ModuleIndex represents an index over a single go module, i.e. a directory
+// with a go.mod file.  Packages are indexed by their import path, derived from
+// the module path declared in the go.mod.
+type ModuleIndex struct {
+	Dir string
+
+	idx *ManualIndex
+}
+
+// Index indexes every package within the module rooted at Dir.  Hidden
+// directories, vendor and testdata directories, and nested modules are not
+// indexed.
+func (idx *ModuleIndex) Index() error {
+	if idx.idx == nil {
+		idx.idx = &ManualIndex{}
+	}
+
+	mod, err := gomod.Load(idx.Dir)
+	if err != nil {
+		return err
+	}
+
+	packages := []string{}
+
+	err = filepath.Walk(mod.Dir, func(path string, stat os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !stat.IsDir() {
+			return nil
+		}
+
+		if path != mod.Dir {
+			switch base := filepath.Base(path); {
+			case base[0] == '.', base[0] == '_', base == "vendor", base == "testdata":
+				return filepath.SkipDir
+			}
+
+			// a nested go.mod marks the start of a different module
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		hasGo, err := hasGo(path)
+		if err != nil {
+			return err
+		}
+
+		if !hasGo {
+			return nil
+		}
+
+		pkg, ok := mod.ImportPath(path)
+		if ok {
+			packages = append(packages, pkg)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return idx.idx.Add(packages...)
+}
+
+// RefreshIfNeeded TODO
+func (idx *ModuleIndex) RefreshIfNeeded() error {
+	return nil
+}
+
+// Search returns any packages that match the query within the module.
+func (idx *ModuleIndex) Search(query string) (results []string, err error) {
+	return idx.idx.Search(query)
+}
@@ -1,6 +1,8 @@
 package pkgindex
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -28,3 +30,22 @@ func searchToRegex(search string) (*regexp.Regexp, error) {
 
 	return regexp.Compile(expr)
 }
+
+// hasGo returns true if the directory has any .go files
+func hasGo(path string) (bool, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return false, err
+	}
+
+	for _, f := range entries {
+		if f.IsDir() {
+			continue
+		}
+
+		if filepath.Ext(f.Name()) == ".go" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
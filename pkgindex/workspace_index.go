@@ -1,7 +1,6 @@
 package pkgindex
 
 import (
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
@@ -40,7 +39,7 @@ func (idx *WorkspaceIndex) Index() error {
 			return filepath.SkipDir
 		}
 
-		hasGo, err := idx.hasGo(path)
+		hasGo, err := hasGo(path)
 		if err != nil {
 			return err
 		}
@@ -66,22 +65,3 @@ func (idx *WorkspaceIndex) RefreshIfNeeded() error {
 	//TODO
 	return nil
 }
-
-// hasGo returns true if the directory has any .go files
-func (idx *WorkspaceIndex) hasGo(path string) (bool, error) {
-	entries, err := ioutil.ReadDir(path)
-	if err != nil {
-		return false, err
-	}
-
-	for _, f := range entries {
-		if f.IsDir() {
-			continue
-		}
-
-		if filepath.Ext(f.Name()) == ".go" {
-			return true, nil
-		}
-	}
-	return false, nil
-}
@@ -0,0 +1,220 @@
+package pkgwatch
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nullstyle/mcdev/gitignore"
+)
+
+// gitPollInterval is how often a watcher paused for git checks whether git has
+// finished
+const gitPollInterval = 250 * time.Millisecond
+
+// gitPauseLimit is the longest a watcher without a MaxWait pauses for git, in
+// case git crashed and left its lock file behind
+const gitPauseLimit = 10 * time.Second
+
+// gitRebaseIdle is how long a rebase's state must go unchanged for the rebase
+// to be considered stopped, e.g. for a conflict or an edit
+const gitRebaseIdle = 2 * time.Second
+
+// gitLockFile is the file, relative to a git directory, whose presence
+// signifies that git is writing the index and working tree
+const gitLockFile = "index.lock"
+
+// gitRebaseDirs are the directories, relative to a git directory, whose
+// presence signifies that a rebase is in progress
+var gitRebaseDirs = []string{"rebase-merge", "rebase-apply"}
+
+// findGitDirs returns the git directories of the repositories containing the
+// provided roots.
+func findGitDirs(roots []string) []string {
+	var result []string
+	seen := map[string]bool{}
+
+	for _, root := range roots {
+		_, dir, ok := gitignore.FindRepository(root)
+		if !ok || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		result = append(result, dir)
+	}
+	return result
+}
+
+// gitBusy returns true if git is rewriting the working tree of any of the
+// watched repositories.  A rebase stopped for the user to resolve a conflict
+// or edit a commit doesn't count, since that is when the user is editing.
+func (w *Watcher) gitBusy() bool {
+	for _, dir := range w.gitDirs {
+		if _, err := os.Stat(filepath.Join(dir, gitLockFile)); err == nil {
+			return true
+		}
+
+		for _, name := range gitRebaseDirs {
+			if rebaseRunning(filepath.Join(dir, name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rebaseRunning returns true if the rebase whose state is kept in dir is
+// applying commits, rather than stopped: the merge backend records the commit
+// it stopped at in stopped-sha, and otherwise a stopped rebase's state stops
+// changing.
+func rebaseRunning(dir string) bool {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return false
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "stopped-sha")); err == nil {
+		return false
+	}
+	return time.Since(stat.ModTime()) < gitRebaseIdle
+}
+
+// waitForGit returns true if the pending changes should wait for git to finish
+// rewriting the working tree.  The wait is limited to MaxWait, or gitPauseLimit
+// without one, after which git is ignored until it is no longer busy.
+func (w *Watcher) waitForGit() bool {
+	if !w.gitBusy() {
+		w.gitStale = false
+		return false
+	}
+	if w.gitStale {
+		return false
+	}
+
+	now := w.clock.Now()
+	if !w.paused {
+		log.Println("waiting for git to finish")
+		w.paused = true
+		w.pausedAt = now
+	}
+
+	limit := gitPauseLimit
+	if w.MaxWait > 0 {
+		limit = w.MaxWait
+	}
+	if now.Sub(w.pausedAt) < limit {
+		return true
+	}
+
+	log.Printf("warn: git still seems busy after %v, no longer waiting for it", limit)
+	w.gitStale = true
+	return false
+}
+
+// coalesce combines the provided changes into a single change of the
+// ManyChanged kind.  See batch for which changes may be combined.
+func coalesce(changes map[string]*Change) *Change {
+	result := &Change{Kind: ManyChanged}
+
+	var dirs []string
+	seen := map[string]bool{}
+	for _, change := range changes {
+		result.Pkgs = append(result.Pkgs, change.Pkg)
+		dirs = append(dirs, change.Dir)
+
+		for _, file := range change.Files {
+			if !seen[file] {
+				seen[file] = true
+				result.Files = append(result.Files, file)
+			}
+		}
+		result.Ops |= change.Ops
+
+		if result.First.IsZero() || (!change.First.IsZero() && change.First.Before(result.First)) {
+			result.First = change.First
+		}
+		if change.Last.After(result.Last) {
+			result.Last = change.Last
+		}
+	}
+
+	sort.Strings(result.Pkgs)
+	sort.Strings(result.Files)
+
+	// packages emitted only as dependents have no directory
+	nonEmpty := dirs[:0]
+	for _, dir := range dirs {
+		if dir != "" {
+			nonEmpty = append(nonEmpty, dir)
+		}
+	}
+
+	pkgs := make([]string, len(result.Pkgs))
+	for i, pkg := range result.Pkgs {
+		pkgs[i] = strings.TrimSuffix(pkg, "/...")
+	}
+
+	result.Pkg = "./..."
+	if prefix := commonPrefix(pkgs, "/"); prefix != "" {
+		result.Pkg = prefix + "/..."
+	}
+	result.Dir = commonPrefix(nonEmpty, string(filepath.Separator))
+	return result
+}
+
+// batch combines the package changes and renames among changes into a single
+// change of the ManyChanged kind, which follows the remaining changes.  A
+// batch of a single package keeps that package's import path and directory.
+func batch(changes []*Change) []*Change {
+	var result []*Change
+	batched := map[string]*Change{}
+	for _, change := range changes {
+		switch change.Kind {
+		case PackageChanged, PackageRenamed:
+			batched[change.Pkg] = change
+		default:
+			result = append(result, change)
+		}
+	}
+
+	if len(batched) == 0 {
+		return result
+	}
+
+	many := coalesce(batched)
+	if len(batched) == 1 {
+		for _, change := range batched {
+			many.Pkg = change.Pkg
+			many.Dir = change.Dir
+		}
+	}
+	return append(result, many)
+}
+
+// commonPrefix returns the longest sequence of leading elements, separated by
+// sep, shared by every one of paths
+func commonPrefix(paths []string, sep string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	prefix := strings.Split(paths[0], sep)
+	for _, p := range paths[1:] {
+		parts := strings.Split(p, sep)
+		if len(parts) < len(prefix) {
+			prefix = prefix[:len(parts)]
+		}
+
+		for i := range prefix {
+			if parts[i] != prefix[i] {
+				prefix = prefix[:i]
+				break
+			}
+		}
+	}
+
+	return strings.Join(prefix, sep)
+}
@@ -0,0 +1,155 @@
+package pkgwatch
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-fsnotify/fsnotify"
+)
+
+// Kind identifies what a Change applies to
+type Kind int
+
+const (
+	// PackageChanged is the kind of a change to the files of a single package
+	PackageChanged Kind = iota
+	// ModuleChanged is the kind of a change to a module's go.mod or go.sum,
+	// which may affect every package within the module
+	ModuleChanged
+	// ManyChanged is the kind of a change combining the changes to many
+	// packages at once, such as when switching git branches
+	ManyChanged
+	// PackageRemoved is the kind of a change removing a package, either by
+	// removing its directory or its last go file
+	PackageRemoved
+	// PackageRenamed is the kind of a change moving a package to a new
+	// directory
+	PackageRenamed
+)
+
+func (k Kind) String() string {
+	switch k {
+	case PackageChanged:
+		return "package"
+	case ModuleChanged:
+		return "module"
+	case ManyChanged:
+		return "many"
+	case PackageRemoved:
+		return "removed"
+	case PackageRenamed:
+		return "renamed"
+	default:
+		return "unknown"
+	}
+}
+
+// Op is a set of filesystem operations, such as fsnotify reports
+type Op fsnotify.Op
+
+var opNames = []struct {
+	op   fsnotify.Op
+	name string
+}{
+	{fsnotify.Create, "create"},
+	{fsnotify.Write, "write"},
+	{fsnotify.Remove, "remove"},
+	{fsnotify.Rename, "rename"},
+	{fsnotify.Chmod, "chmod"},
+}
+
+// String returns the names of the operations in the set, separated by "|",
+// e.g. "create|write"
+func (o Op) String() string {
+	var names []string
+	for _, op := range opNames {
+		if fsnotify.Op(o)&op.op != 0 {
+			names = append(names, op.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Change describes the changes made to a single go package, or to a module as
+// a whole, during one debounce window.
+type Change struct {
+	// Kind is the kind of the change
+	Kind Kind
+	// Pkg is the import path of the changed package.  For module changes it is
+	// the pattern matching every package of the module, e.g.
+	// "example.com/mod/...", and for many changes the pattern matching every
+	// package underneath the longest import path shared by the changed
+	// packages, unless a batch holds just one package.
+	Pkg string
+	// Pkgs holds the import paths of the combined changes, sorted, and is only
+	// set for many changes
+	Pkgs []string
+	// Module is the path of the changed module, and is only set for module
+	// changes
+	Module string
+	// OldPkg and OldDir are the import path and directory a package was moved
+	// from, and are only set for renames
+	OldPkg string
+	OldDir string
+	// Dir is the absolute path of the package's directory, or for many
+	// changes the directory shared by the changed packages
+	Dir string
+	// Files holds the absolute paths of the files that changed, sorted.  It is
+	// empty for packages emitted only because they depend upon a changed
+	// package.
+	Files []string
+	// Ops is the union of the filesystem operations that triggered the change
+	Ops Op
+	// First and Last are the times the first and last filesystem events
+	// contributing to the change were observed
+	First time.Time
+	Last  time.Time
+}
+
+// Merge records the events and packages of other as part of the change
+func (c *Change) Merge(other *Change) {
+	first, last := c.First, c.Last
+	for _, file := range other.Files {
+		c.add(fsnotify.Event{Name: file}, last)
+	}
+	c.First, c.Last = first, last
+	c.Ops |= other.Ops
+
+	if !other.First.IsZero() && (c.First.IsZero() || other.First.Before(c.First)) {
+		c.First = other.First
+	}
+	if other.Last.After(c.Last) {
+		c.Last = other.Last
+	}
+
+	for _, pkg := range other.Pkgs {
+		i := sort.SearchStrings(c.Pkgs, pkg)
+		if i < len(c.Pkgs) && c.Pkgs[i] == pkg {
+			continue
+		}
+		c.Pkgs = append(c.Pkgs, "")
+		copy(c.Pkgs[i+1:], c.Pkgs[i:])
+		c.Pkgs[i] = pkg
+	}
+}
+
+// add records the provided filesystem event, observed at the provided time, as
+// part of the change.
+func (c *Change) add(event fsnotify.Event, at time.Time) {
+	c.Ops |= Op(event.Op)
+
+	if c.First.IsZero() {
+		c.First = at
+	}
+	c.Last = at
+
+	i := sort.SearchStrings(c.Files, event.Name)
+	if i < len(c.Files) && c.Files[i] == event.Name {
+		return
+	}
+
+	c.Files = append(c.Files, "")
+	copy(c.Files[i+1:], c.Files[i:])
+	c.Files[i] = event.Name
+}
@@ -0,0 +1,60 @@
+package pkgwatch
+
+import (
+	"time"
+
+	"github.com/go-fsnotify/fsnotify"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Change", func() {
+	var subject *Change
+	start := time.Unix(1000, 0)
+
+	BeforeEach(func() {
+		subject = &Change{Pkg: "example.com/pkg", Dir: "/src/pkg"}
+		subject.add(fsnotify.Event{Name: "/src/pkg/b.go", Op: fsnotify.Write}, start)
+		subject.add(fsnotify.Event{Name: "/src/pkg/a.go", Op: fsnotify.Create}, start.Add(time.Second))
+		subject.add(fsnotify.Event{Name: "/src/pkg/b.go", Op: fsnotify.Write}, start.Add(2*time.Second))
+	})
+
+	It("records each changed file once, sorted", func() {
+		Expect(subject.Files).To(Equal([]string{"/src/pkg/a.go", "/src/pkg/b.go"}))
+	})
+
+	It("records the union of the observed operations", func() {
+		Expect(subject.Ops).To(Equal(Op(fsnotify.Create | fsnotify.Write)))
+	})
+
+	It("renders the operations by name", func() {
+		Expect(subject.Ops.String()).To(Equal("create|write"))
+		Expect(Op(0).String()).To(Equal(""))
+	})
+
+	It("records when the first and last events were observed", func() {
+		Expect(subject.First).To(Equal(start))
+		Expect(subject.Last).To(Equal(start.Add(2 * time.Second)))
+	})
+
+	Describe("Merge", func() {
+		It("records the union of both changes", func() {
+			subject.Pkgs = []string{"example.com/b", "example.com/pkg"}
+			other := &Change{
+				Pkgs:  []string{"example.com/a", "example.com/b"},
+				Files: []string{"/src/a/a.go", "/src/pkg/b.go"},
+				Ops:   Op(fsnotify.Remove),
+				First: start.Add(-time.Second),
+				Last:  start.Add(time.Second),
+			}
+			subject.Merge(other)
+
+			Expect(subject.Pkgs).To(Equal([]string{"example.com/a", "example.com/b", "example.com/pkg"}))
+			Expect(subject.Files).To(Equal([]string{"/src/a/a.go", "/src/pkg/a.go", "/src/pkg/b.go"}))
+			Expect(subject.Ops).To(Equal(Op(fsnotify.Create | fsnotify.Write | fsnotify.Remove)))
+			Expect(subject.First).To(Equal(start.Add(-time.Second)))
+			Expect(subject.Last).To(Equal(start.Add(2 * time.Second)))
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package pkgwatch
+
+import (
+	"bytes"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-fsnotify/fsnotify"
+)
+
+// NewBuildContext returns a build context for evaluating the build constraints
+// of changed files against the provided GOOS, GOARCH and build tags.  Empty
+// values default to those of the running toolchain.
+func NewBuildContext(goos, goarch string, tags []string) *build.Context {
+	ctx := build.Default
+	if goos != "" {
+		ctx.GOOS = goos
+	}
+	if goarch != "" {
+		ctx.GOARCH = goarch
+	}
+	ctx.BuildTags = tags
+
+	// the file of a remove event is already gone, so only the constraints
+	// implied by its name can be evaluated.
+	ctx.OpenFile = func(path string) (io.ReadCloser, error) {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return ioutil.NopCloser(&bytes.Buffer{}), nil
+		}
+		return f, err
+	}
+	return &ctx
+}
+
+// isConstrained returns true if the event's file is a go file that is excluded
+// by its build constraints, both now and when last seen.  It always returns
+// false unless the watcher's Build context is set.
+func (w *Watcher) isConstrained(event fsnotify.Event) bool {
+	file := event.Name
+	if w.Build == nil || filepath.Ext(file) != ".go" {
+		return false
+	}
+
+	previous, seen := w.built[file]
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		delete(w.built, file)
+		if seen {
+			return !previous
+		}
+
+		match, _ := w.Build.MatchFile(filepath.Dir(file), filepath.Base(file))
+		return !match
+	}
+
+	current := w.recordBuilt(file)
+	return !current && !(seen && previous)
+}
+
+// recordBuilt evaluates the build constraints of file, recording the result
+// so that a change that excludes a previously built file is still noticed.
+func (w *Watcher) recordBuilt(file string) bool {
+	if w.Build == nil || filepath.Ext(file) != ".go" {
+		return true
+	}
+
+	match, err := w.Build.MatchFile(filepath.Dir(file), filepath.Base(file))
+	if err != nil {
+		// files that can't be evaluated are treated as changed
+		match = true
+	}
+
+	w.built[file] = match
+	return match
+}
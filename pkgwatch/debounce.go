@@ -0,0 +1,44 @@
+package pkgwatch
+
+import (
+	"fmt"
+)
+
+// DebounceMode selects when a Watcher emits the changes of a burst of events
+type DebounceMode int
+
+const (
+	// TrailingDebounce emits changes once no events have been received for the
+	// debounce duration
+	TrailingDebounce DebounceMode = iota
+	// LeadingDebounce emits the first change of a burst immediately, and the
+	// changes that follow it once no events have been received for the
+	// debounce duration
+	LeadingDebounce
+)
+
+// String returns the name of the mode, as accepted by Set
+func (m DebounceMode) String() string {
+	switch m {
+	case TrailingDebounce:
+		return "trailing"
+	case LeadingDebounce:
+		return "leading"
+	default:
+		return fmt.Sprintf("DebounceMode(%d)", int(m))
+	}
+}
+
+// Set parses the name of a mode, allowing a DebounceMode to be used as a
+// flag.Value
+func (m *DebounceMode) Set(name string) error {
+	switch name {
+	case "trailing":
+		*m = TrailingDebounce
+	case "leading":
+		*m = LeadingDebounce
+	default:
+		return fmt.Errorf("unknown debounce mode %q, expected leading or trailing", name)
+	}
+	return nil
+}
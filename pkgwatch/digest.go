@@ -0,0 +1,110 @@
+package pkgwatch
+
+import (
+	"crypto/sha1"
+	"go/scanner"
+	"go/token"
+	"hash"
+	"io/ioutil"
+	"strings"
+)
+
+// digest is a hash of a go file's content
+type digest [sha1.Size]byte
+
+// digestFile hashes the file at path.  When tokens is true only the file's go
+// tokens contribute to the hash, so that changes to comments or formatting
+// don't change the digest.  Comments that affect the build still count: the
+// //go: directives, +build lines and the cgo preamble preceding import "C".
+func digestFile(path string, tokens bool) (digest, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return digest{}, err
+	}
+
+	if !tokens {
+		return sha1.Sum(src), nil
+	}
+
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile(path, fset.Base(), len(src))
+	// errors are ignored: a file being edited still hashes consistently
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	h := sha1.New()
+
+	// group is the comment group being scanned, ending on groupEnd, and
+	// preamble the group immediately preceding the last import keyword
+	var group, preamble []string
+	var groupEnd int
+	var prev token.Token
+
+	// semicolon is set while a semicolon is held back, see below
+	semicolon := false
+
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+
+		if tok == token.COMMENT {
+			line := file.Line(pos)
+			if line > groupEnd+1 {
+				group = nil
+			}
+			group = append(group, lit)
+			groupEnd = line + strings.Count(lit, "\n")
+
+			if isDirective(lit) {
+				writeToken(h, tok, lit)
+			}
+			continue
+		}
+
+		switch {
+		case tok == token.IMPORT:
+			preamble = nil
+			if len(group) > 0 && groupEnd+1 >= file.Line(pos) {
+				preamble = group
+			}
+		case tok == token.STRING && lit == `"C"` && prev == token.IMPORT:
+			for _, comment := range preamble {
+				writeToken(h, token.COMMENT, comment)
+			}
+		}
+		group = nil
+
+		// semicolons, whether written or inserted at the end of a line, separate
+		// statements and so count, but one may be omitted before a closing
+		// parenthesis or brace, or at the end of the file, so those are skipped.
+		if tok == token.SEMICOLON {
+			semicolon = true
+			continue
+		}
+		if semicolon && tok != token.RPAREN && tok != token.RBRACE {
+			writeToken(h, token.SEMICOLON, ";")
+		}
+		semicolon = false
+
+		writeToken(h, tok, lit)
+		prev = tok
+	}
+
+	var result digest
+	copy(result[:], h.Sum(nil))
+	return result, nil
+}
+
+func writeToken(h hash.Hash, tok token.Token, lit string) {
+	h.Write([]byte(tok.String()))
+	h.Write([]byte{0})
+	h.Write([]byte(lit))
+	h.Write([]byte{0})
+}
+
+// isDirective returns true if comment is a //go: directive or a +build line
+func isDirective(comment string) bool {
+	return strings.HasPrefix(comment, "//go:") || strings.HasPrefix(comment, "// +build")
+}
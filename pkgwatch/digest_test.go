@@ -0,0 +1,93 @@
+package pkgwatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("digestFile", func() {
+	var dir string
+
+	sum := func(contents string, tokens bool) digest {
+		path := filepath.Join(dir, "file.go")
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		result, err := digestFile(path, tokens)
+		Expect(err).To(BeNil())
+		return result
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-digest")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("distinguishes any change to the content", func() {
+		Expect(sum("package a\n", false)).NotTo(Equal(sum("package a \n", false)))
+	})
+
+	Context("when hashing tokens", func() {
+		original := "package a\n\nfunc A() int {\n\treturn 1\n}\n"
+
+		It("ignores comments", func() {
+			Expect(sum(original, true)).To(Equal(sum("// Package a\npackage a\n\n// A is a\nfunc A() int {\n\treturn 1 // one\n}\n", true)))
+		})
+
+		It("ignores formatting", func() {
+			Expect(sum(original, true)).To(Equal(sum("package a\nfunc A()   int { return 1 }", true)))
+		})
+
+		It("distinguishes changes to the code", func() {
+			Expect(sum(original, true)).NotTo(Equal(sum("package a\n\nfunc A() int {\n\treturn 2\n}\n", true)))
+		})
+
+		It("distinguishes changes to line breaks that separate statements", func() {
+			Expect(sum("package a\n\nfunc A() {\n\tx := g\n\t(h)()\n}\n", true)).NotTo(Equal(sum("package a\n\nfunc A() {\n\tx := g(h)()\n}\n", true)))
+			Expect(sum("package a\n\nfunc A() int {\n\treturn\n\tx\n}\n", true)).NotTo(Equal(sum("package a\n\nfunc A() int {\n\treturn x\n}\n", true)))
+		})
+
+		It("treats written and inserted semicolons alike", func() {
+			Expect(sum(original, true)).To(Equal(sum("package a;\n\nfunc A() int {\n\treturn 1;\n};\n", true)))
+		})
+
+		It("distinguishes changes to build constraints", func() {
+			Expect(sum("//go:build linux\n\n"+original, true)).NotTo(Equal(sum("//go:build darwin\n\n"+original, true)))
+			Expect(sum("// +build linux\n\n"+original, true)).NotTo(Equal(sum("// +build darwin\n\n"+original, true)))
+		})
+
+		It("distinguishes changes to embed patterns", func() {
+			embed := func(pattern string) digest {
+				return sum("package a\n\nimport _ \"embed\"\n\n//go:embed "+pattern+"\nvar s string\n", true)
+			}
+			Expect(embed("a.txt")).NotTo(Equal(embed("b.txt")))
+		})
+
+		Context("with cgo", func() {
+			cgo := func(preamble string) digest {
+				return sum("package a\n\n"+preamble+"import \"C\"\n", true)
+			}
+
+			It("distinguishes changes to the preamble", func() {
+				Expect(cgo("// #include <stdio.h>\n")).NotTo(Equal(cgo("// #include <stdlib.h>\n")))
+				Expect(cgo("/*\n#include <stdio.h>\n*/\n")).NotTo(Equal(cgo("/*\n#include <stdlib.h>\n*/\n")))
+			})
+
+			It("ignores comments separated from the import", func() {
+				Expect(cgo("// one\n\n")).To(Equal(cgo("// two\n\n")))
+			})
+		})
+	})
+
+	It("fails for missing files", func() {
+		_, err := digestFile(filepath.Join(dir, "missing.go"), false)
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,152 @@
+package pkgwatch
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// parseEmbeds returns the patterns of the //go:embed directives in the go
+// files of dir, including its tests.  Files that can't be read are skipped.
+func parseEmbeds(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []string
+	seen := map[string]bool{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		found, err := scanEmbeds(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("warn: %v", err)
+			continue
+		}
+
+		for _, pattern := range found {
+			if seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns, nil
+}
+
+// scanEmbeds returns the patterns of the //go:embed directives in a go file.
+// The file is read whole, since generated files may have arbitrarily long
+// lines.
+func scanEmbeds(file string) ([]string, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if !strings.HasPrefix(line, "//go:embed ") && !strings.HasPrefix(line, "//go:embed\t") {
+			continue
+		}
+
+		patterns = append(patterns, splitEmbedArgs(line[len("//go:embed"):])...)
+	}
+
+	return patterns, nil
+}
+
+// splitEmbedArgs splits the arguments of a //go:embed directive, which are
+// separated by spaces and may be quoted using either double quotes or
+// backquotes.  Malformed arguments are skipped.
+func splitEmbedArgs(args string) []string {
+	var result []string
+
+	for {
+		args = strings.TrimLeft(args, " \t")
+		if args == "" {
+			return result
+		}
+
+		var arg string
+		switch args[0] {
+		case '"', '`':
+			i := 1
+			for ; i < len(args); i++ {
+				if args[i] == '\\' && args[0] == '"' {
+					i++
+					continue
+				}
+				if args[i] == args[0] {
+					break
+				}
+			}
+			if i >= len(args) {
+				return result
+			}
+
+			unquoted, err := strconv.Unquote(args[:i+1])
+			args = args[i+1:]
+			if err != nil {
+				continue
+			}
+			arg = unquoted
+		default:
+			i := strings.IndexAny(args, " \t")
+			if i < 0 {
+				i = len(args)
+			}
+			arg, args = args[:i], args[i:]
+		}
+
+		result = append(result, arg)
+	}
+}
+
+// matchEmbed returns true if a //go:embed pattern embeds the file at rel, a
+// slash-separated path relative to the embedding package's directory.  When a
+// pattern matches a directory, the files within it are embedded except those
+// whose path has an element beginning with '.' or '_', unless the pattern has
+// the "all:" prefix.
+func matchEmbed(pattern, rel string) bool {
+	all := strings.HasPrefix(pattern, "all:")
+	pattern = strings.TrimPrefix(pattern, "all:")
+
+	parts := strings.Split(rel, "/")
+	for i := 1; i <= len(parts); i++ {
+		ok, _ := path.Match(pattern, strings.Join(parts[:i], "/"))
+		if !ok {
+			continue
+		}
+
+		if i == len(parts) || all {
+			return true
+		}
+
+		for _, part := range parts[i:] {
+			if strings.HasPrefix(part, ".") || strings.HasPrefix(part, "_") {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
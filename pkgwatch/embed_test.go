@@ -0,0 +1,89 @@
+package pkgwatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("parseEmbeds", func() {
+	var dir string
+
+	write := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-embed")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reads the patterns of every directive", func() {
+		write("assets.go", "package a\n\nimport \"embed\"\n\n//go:embed static/*.html templates\n//go:embed \"with space.txt\" `raw.sql`\nvar assets embed.FS\n")
+		write("assets_test.go", "package a\n\n//go:embed testdata/golden.txt\nvar golden string\n")
+		write("other.go", "package a\n\n// go:embed ignored.txt\nconst x = `\n//go:embed\n`\n")
+
+		patterns, err := parseEmbeds(dir)
+		Expect(err).To(BeNil())
+		Expect(patterns).To(ConsistOf(
+			"static/*.html",
+			"templates",
+			"with space.txt",
+			"raw.sql",
+			"testdata/golden.txt",
+		))
+	})
+
+	It("reads files with very long lines", func() {
+		long := strings.Repeat("x", 70000)
+		write("bindata.go", "package a\n\nvar data = \""+long+"\"\n\n//go:embed static\nvar static string\n")
+
+		patterns, err := parseEmbeds(dir)
+		Expect(err).To(BeNil())
+		Expect(patterns).To(Equal([]string{"static"}))
+	})
+
+	It("skips files that can't be read", func() {
+		Expect(os.Symlink("loop.go", filepath.Join(dir, "loop.go"))).To(Succeed())
+		write("assets.go", "package a\n\n//go:embed static\nvar static string\n")
+
+		patterns, err := parseEmbeds(dir)
+		Expect(err).To(BeNil())
+		Expect(patterns).To(Equal([]string{"static"}))
+	})
+
+	It("returns nothing for missing directories", func() {
+		patterns, err := parseEmbeds(filepath.Join(dir, "missing"))
+		Expect(err).To(BeNil())
+		Expect(patterns).To(BeEmpty())
+	})
+})
+
+var _ = Describe("matchEmbed", func() {
+	It("matches files", func() {
+		Expect(matchEmbed("static/*.html", "static/index.html")).To(BeTrue())
+		Expect(matchEmbed("static/*.html", "static/app.css")).To(BeFalse())
+	})
+
+	It("matches the files within directories", func() {
+		Expect(matchEmbed("migrations", "migrations/001_init.sql")).To(BeTrue())
+		Expect(matchEmbed("migrations", "migrations/v2/002_users.sql")).To(BeTrue())
+		Expect(matchEmbed("migrations", "other/001_init.sql")).To(BeFalse())
+	})
+
+	It("skips hidden files within directories unless all: is used", func() {
+		Expect(matchEmbed("static", "static/.keep")).To(BeFalse())
+		Expect(matchEmbed("static", "static/_draft/index.html")).To(BeFalse())
+		Expect(matchEmbed("all:static", "static/.keep")).To(BeTrue())
+		Expect(matchEmbed("static/.keep", "static/.keep")).To(BeTrue())
+	})
+})
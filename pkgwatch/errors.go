@@ -0,0 +1,53 @@
+package pkgwatch
+
+import (
+	"fmt"
+	"os"
+)
+
+// The operations that an Error can be reported for
+const (
+	// WalkOp is the initial traversal of a watched directory tree
+	WalkOp = "walk"
+	// WatchOp is the adding of a directory to the set of watched directories
+	WatchOp = "watch"
+	// StatOp is the inspection of a path named by a filesystem event
+	StatOp = "stat"
+	// ResolveOp is the resolution of a directory's package import path
+	ResolveOp = "resolve"
+	// NotifyOp is the delivery of events by the underlying filesystem watcher
+	NotifyOp = "notify"
+)
+
+// Error is the type of every error reported on a Watcher's Errors() channel.
+// None of them stop the watcher; it is up to the receiver to decide whether
+// an error warrants aborting.
+type Error struct {
+	// Op is the operation that failed, e.g. WalkOp
+	Op string
+	// Path is the file or directory being operated upon, if any
+	Path string
+	// Err is the underlying error
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("pkgwatch: %s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("pkgwatch: %s %s: %v", e.Op, e.Path, e.Err)
+}
+
+// Transient returns true if the error was caused by a race with the
+// filesystem, such as a temporary directory disappearing while it was being
+// walked, that the watcher can safely ignore.
+func (e *Error) Transient() bool {
+	return os.IsNotExist(e.Err)
+}
+
+// IsTransient returns true if err is a transient *Error.  See
+// Error.Transient() for details.
+func IsTransient(err error) bool {
+	werr, ok := err.(*Error)
+	return ok && werr.Transient()
+}
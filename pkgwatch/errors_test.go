@@ -0,0 +1,24 @@
+package pkgwatch
+
+import (
+	"errors"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IsTransient", func() {
+	It("is true for errors caused by a path disappearing", func() {
+		err := &Error{Op: WalkOp, Path: "/tmp/gone", Err: &os.PathError{Op: "lstat", Path: "/tmp/gone", Err: os.ErrNotExist}}
+		Expect(IsTransient(err)).To(BeTrue())
+	})
+
+	It("is false for other errors", func() {
+		Expect(IsTransient(&Error{Op: WatchOp, Err: os.ErrPermission})).To(BeFalse())
+	})
+
+	It("is false for errors not reported by a watcher", func() {
+		Expect(IsTransient(errors.New("boom"))).To(BeFalse())
+	})
+})
@@ -0,0 +1,149 @@
+package pkgwatch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-fsnotify/fsnotify"
+)
+
+// FakeSource is a Source whose events are provided by calling Send, for
+// deterministic tests of code built upon a Watcher.
+type FakeSource struct {
+	events chan fsnotify.Event
+	errors chan error
+
+	lock   sync.Mutex
+	dirs   map[string]bool
+	closed sync.Once
+}
+
+// NewFakeSource returns a FakeSource with no watched directories
+func NewFakeSource() *FakeSource {
+	return &FakeSource{
+		events: make(chan fsnotify.Event),
+		errors: make(chan error),
+		dirs:   map[string]bool{},
+	}
+}
+
+// Add records dir as watched
+func (s *FakeSource) Add(dir string) error {
+	s.lock.Lock()
+	s.dirs[dir] = true
+	s.lock.Unlock()
+	return nil
+}
+
+// Remove records dir as no longer watched
+func (s *FakeSource) Remove(dir string) error {
+	s.lock.Lock()
+	delete(s.dirs, dir)
+	s.lock.Unlock()
+	return nil
+}
+
+// Events returns the channel on which events passed to Send are delivered
+func (s *FakeSource) Events() <-chan fsnotify.Event {
+	return s.events
+}
+
+// Errors returns the channel on which errors passed to SendError are delivered
+func (s *FakeSource) Errors() <-chan error {
+	return s.errors
+}
+
+// Close closes the source's channels.  Closing the source more than once has
+// no further effect.
+func (s *FakeSource) Close() error {
+	s.closed.Do(func() {
+		close(s.events)
+		close(s.errors)
+	})
+	return nil
+}
+
+// Send delivers event, blocking until it has been received
+func (s *FakeSource) Send(event fsnotify.Event) {
+	s.events <- event
+}
+
+// SendError delivers err, blocking until it has been received
+func (s *FakeSource) SendError(err error) {
+	s.errors <- err
+}
+
+// Watched returns the watched directories, sorted
+func (s *FakeSource) Watched() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return sortedKeys(s.dirs)
+}
+
+// FakeClock is a Clock whose time only changes when Advance is called.
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// NewFakeClock returns a FakeClock whose current time is now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's current time
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the clock's time once the clock has
+// been advanced by at least d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	w := fakeWaiter{deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return w.c
+	}
+
+	c.waiters = append(c.waiters, w)
+	return w.c
+}
+
+// Advance moves the clock forward by d, firing every channel returned by
+// After whose deadline has been reached.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns the number of channels returned by After that have yet to
+// fire.  Tests can use it to wait until the code under test is blocked on the
+// clock.
+func (c *FakeClock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
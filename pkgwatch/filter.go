@@ -0,0 +1,208 @@
+package pkgwatch
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-fsnotify/fsnotify"
+	"github.com/nullstyle/mcdev/gitignore"
+)
+
+// DefaultIncludeFiles are the file patterns used when a Watcher's IncludeFiles
+// is nil
+var DefaultIncludeFiles = []string{"*.go"}
+
+// DefaultExcludeDirs are the directory patterns used when a Watcher's
+// ExcludeDirs is nil: hidden directories and vendored code are not watched.
+var DefaultExcludeDirs = []string{".*", "vendor"}
+
+// matchAny returns true if any of the provided glob patterns matches rel, the
+// slash-separated path of a file relative to a watched root.  Patterns
+// containing a slash are matched against the whole of rel, while other
+// patterns are matched against its final element.  See path.Match for the
+// pattern syntax.
+func matchAny(patterns []string, rel string) bool {
+	base := path.Base(rel)
+
+	for _, pattern := range patterns {
+		name := base
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rel returns the slash-separated path of p relative to the watched root that
+// contains it, or just its base name if it isn't underneath any root.
+func (w *Watcher) rel(p string) string {
+	for _, root := range w.roots {
+		if p == root {
+			return "."
+		}
+
+		if strings.HasPrefix(p, root+string(filepath.Separator)) {
+			return filepath.ToSlash(p[len(root)+1:])
+		}
+	}
+	return filepath.Base(p)
+}
+
+// isRoot returns true if dir is one of the watched roots
+func (w *Watcher) isRoot(dir string) bool {
+	for _, root := range w.roots {
+		if dir == root {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcludedDir returns true if the directory should not be watched.  Roots are
+// always watched.
+func (w *Watcher) isExcludedDir(dir string) bool {
+	if w.isRoot(dir) {
+		return false
+	}
+
+	rel := w.rel(dir)
+	if matchAny(w.IncludeDirs, rel) {
+		return false
+	}
+
+	if w.isIgnored(dir, true) {
+		return true
+	}
+
+	exclude := w.ExcludeDirs
+	if exclude == nil {
+		exclude = DefaultExcludeDirs
+	}
+	return matchAny(exclude, rel)
+}
+
+// isExcludedFile returns true if the file matches ExcludeFiles or is ignored
+// by git
+func (w *Watcher) isExcludedFile(file string) bool {
+	return matchAny(w.ExcludeFiles, w.rel(file)) || w.isIgnored(file, false)
+}
+
+// isIncludedFile returns true if changes to the file should be processed
+func (w *Watcher) isIncludedFile(file string) bool {
+	if w.isExcludedFile(file) {
+		return false
+	}
+	rel := w.rel(file)
+
+	include := w.IncludeFiles
+	if include == nil {
+		include = DefaultIncludeFiles
+	}
+	return matchAny(include, rel)
+}
+
+// isIgnored returns true if the watcher honors .gitignore files and path is
+// ignored by them
+func (w *Watcher) isIgnored(path string, isDir bool) bool {
+	var matcher *gitignore.Matcher
+	for _, m := range w.ignores {
+		if isUnderAny(path, []string{m.Root}) && (matcher == nil || len(m.Root) > len(matcher.Root)) {
+			matcher = m
+		}
+	}
+	return matcher != nil && matcher.Match(path, isDir)
+}
+
+// processIgnoreEvent reloads a changed .gitignore file, rescanning its
+// directory for anything that is no longer ignored.  Directories that become
+// ignored stay watched, but changes within them are dropped.
+func (w *Watcher) processIgnoreEvent(event fsnotify.Event) {
+	if len(w.ignores) == 0 || filepath.Base(event.Name) != ".gitignore" {
+		return
+	}
+
+	dir := filepath.Dir(event.Name)
+	for _, m := range w.ignores {
+		m.Invalidate(dir)
+	}
+
+	if w.watched[dir] {
+		w.rescan(dir)
+	}
+}
+
+// newIgnoreMatchers returns a matcher for each of the repositories containing
+// the provided roots
+func newIgnoreMatchers(roots []string) []*gitignore.Matcher {
+	var result []*gitignore.Matcher
+	seen := map[string]bool{}
+
+	for _, root := range roots {
+		m := gitignore.New(root)
+		if seen[m.Root] {
+			continue
+		}
+		seen[m.Root] = true
+		result = append(result, m)
+	}
+	return result
+}
+
+// packageDir returns the directory of the go package that a change to file
+// affects.  Files within a testdata directory affect the package containing
+// that directory.  Other go files belong to the package in their own directory,
+// while any other file is mapped to the package of its nearest ancestor
+// directory that contains go files.  Only directories underneath the watched
+// roots count as testdata directories.
+func (w *Watcher) packageDir(file string) (string, bool) {
+	dir := filepath.Dir(file)
+
+	if rel := w.rel(dir); rel != "." {
+		parts := strings.Split(rel, "/")
+		for i, part := range parts {
+			if part == "testdata" {
+				for range parts[i:] {
+					dir = filepath.Dir(dir)
+				}
+				break
+			}
+		}
+	}
+
+	if filepath.Ext(file) == ".go" && dir == filepath.Dir(file) {
+		return dir, true
+	}
+
+	for {
+		if hasGoFiles(dir) {
+			return dir, true
+		}
+
+		parent := filepath.Dir(dir)
+		if w.isRoot(dir) || parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// hasGoFiles returns true if dir contains any go files
+func hasGoFiles(dir string) bool {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".go" {
+			return true
+		}
+	}
+	return false
+}
@@ -19,7 +19,8 @@ func init() {
 	for _, up := range unexpanded {
 		ap, err := filepath.Abs(up)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("warn: ignoring GOPATH entry %s: %v", up, err)
+			continue
 		}
 
 		gopath = append(gopath, ap)
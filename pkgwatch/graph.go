@@ -0,0 +1,218 @@
+package pkgwatch
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Graph is an import graph of go packages, keyed by import path.  Graph is
+// safe for concurrent use.
+type Graph struct {
+	mu        sync.RWMutex
+	imports   map[string]map[string]bool
+	importers map[string]map[string]bool
+}
+
+// NewGraph returns an empty import graph
+func NewGraph() *Graph {
+	return &Graph{
+		imports:   map[string]map[string]bool{},
+		importers: map[string]map[string]bool{},
+	}
+}
+
+// Set records pkg as importing the provided packages, replacing any imports
+// previously recorded for pkg.
+func (g *Graph) Set(pkg string, imports []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.remove(pkg)
+
+	edges := map[string]bool{}
+	for _, imp := range imports {
+		if imp == pkg {
+			continue
+		}
+
+		edges[imp] = true
+		if g.importers[imp] == nil {
+			g.importers[imp] = map[string]bool{}
+		}
+		g.importers[imp][pkg] = true
+	}
+	g.imports[pkg] = edges
+}
+
+// Remove forgets the imports of pkg
+func (g *Graph) Remove(pkg string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.remove(pkg)
+}
+
+// Imports returns the packages directly imported by pkg, sorted.
+func (g *Graph) Imports(pkg string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return sortedKeys(g.imports[pkg])
+}
+
+// Dependents returns every package that imports pkg, directly or
+// transitively, sorted.
+func (g *Graph) Dependents(pkg string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	seen := map[string]bool{}
+	queue := []string{pkg}
+
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+
+		for importer := range g.importers[next] {
+			if seen[importer] || importer == pkg {
+				continue
+			}
+			seen[importer] = true
+			queue = append(queue, importer)
+		}
+	}
+
+	return sortedKeys(seen)
+}
+
+// Dependencies returns every package that pkg imports, directly or
+// transitively, sorted.
+func (g *Graph) Dependencies(pkg string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	seen := map[string]bool{}
+	queue := []string{pkg}
+
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+
+		for imp := range g.imports[next] {
+			if seen[imp] || imp == pkg {
+				continue
+			}
+			seen[imp] = true
+			queue = append(queue, imp)
+		}
+	}
+
+	return sortedKeys(seen)
+}
+
+// Sort returns pkgs ordered such that each package comes after every other
+// one it imports, directly or transitively.  Otherwise, packages are ordered
+// lexically, and import cycles, which test files can introduce, are broken
+// arbitrarily but deterministically.
+func (g *Graph) Sort(pkgs []string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	wanted := map[string]bool{}
+	for _, pkg := range pkgs {
+		wanted[pkg] = true
+	}
+
+	seen := map[string]bool{}
+	result := make([]string, 0, len(wanted))
+
+	var visit func(pkg string)
+	visit = func(pkg string) {
+		if seen[pkg] {
+			return
+		}
+		seen[pkg] = true
+
+		for _, imp := range sortedKeys(g.imports[pkg]) {
+			visit(imp)
+		}
+
+		if wanted[pkg] {
+			result = append(result, pkg)
+		}
+	}
+
+	for _, pkg := range sortedKeys(wanted) {
+		visit(pkg)
+	}
+
+	return result
+}
+
+func (g *Graph) remove(pkg string) {
+	for imp := range g.imports[pkg] {
+		delete(g.importers[imp], pkg)
+		if len(g.importers[imp]) == 0 {
+			delete(g.importers, imp)
+		}
+	}
+	delete(g.imports, pkg)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for key := range set {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// parseImports parses the import clauses of every go file in dir, including
+// test files, returning the union of imported packages.  hasGo is false if dir
+// contains no go files or no longer exists.
+func parseImports(dir string) (imports []string, hasGo bool, err error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	fset := token.NewFileSet()
+	seen := map[string]bool{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" || strings.HasPrefix(name, ".") {
+			continue
+		}
+		hasGo = true
+
+		// a file being edited may not parse completely, but the parser still
+		// returns whatever imports it managed to read.
+		f, _ := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ImportsOnly)
+		if f == nil {
+			continue
+		}
+
+		for _, spec := range f.Imports {
+			imp, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || seen[imp] {
+				continue
+			}
+			seen[imp] = true
+			imports = append(imports, imp)
+		}
+	}
+
+	return imports, hasGo, nil
+}
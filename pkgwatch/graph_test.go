@@ -0,0 +1,123 @@
+package pkgwatch
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Graph", func() {
+	var subject *Graph
+
+	BeforeEach(func() {
+		subject = NewGraph()
+		subject.Set("example.com/api", []string{"example.com/store", "net/http"})
+		subject.Set("example.com/store", []string{"example.com/internal/db"})
+		subject.Set("example.com/cmd/server", []string{"example.com/api"})
+		subject.Set("example.com/internal/db", []string{"database/sql"})
+	})
+
+	Describe("Imports", func() {
+		It("returns the direct imports of the package", func() {
+			Expect(subject.Imports("example.com/api")).To(Equal([]string{
+				"example.com/store",
+				"net/http",
+			}))
+		})
+	})
+
+	Describe("Dependents", func() {
+		It("returns all transitive importers", func() {
+			Expect(subject.Dependents("example.com/internal/db")).To(Equal([]string{
+				"example.com/api",
+				"example.com/cmd/server",
+				"example.com/store",
+			}))
+		})
+
+		It("returns nothing for packages nobody imports", func() {
+			Expect(subject.Dependents("example.com/cmd/server")).To(BeEmpty())
+		})
+
+		It("doesn't loop on import cycles", func() {
+			subject.Set("example.com/internal/db", []string{"example.com/api"})
+			Expect(subject.Dependents("example.com/api")).To(ConsistOf(
+				"example.com/cmd/server",
+				"example.com/internal/db",
+				"example.com/store",
+			))
+		})
+	})
+
+	Describe("Dependencies", func() {
+		It("returns all transitive imports", func() {
+			Expect(subject.Dependencies("example.com/api")).To(Equal([]string{
+				"database/sql",
+				"example.com/internal/db",
+				"example.com/store",
+				"net/http",
+			}))
+		})
+
+		It("doesn't loop on import cycles", func() {
+			subject.Set("example.com/internal/db", []string{"example.com/api"})
+			Expect(subject.Dependencies("example.com/store")).To(ConsistOf(
+				"example.com/api",
+				"example.com/internal/db",
+				"net/http",
+			))
+		})
+	})
+
+	Describe("Sort", func() {
+		It("orders packages after the packages they import", func() {
+			Expect(subject.Sort([]string{
+				"example.com/cmd/server",
+				"example.com/api",
+				"example.com/internal/db",
+				"example.com/store",
+			})).To(Equal([]string{
+				"example.com/internal/db",
+				"example.com/store",
+				"example.com/api",
+				"example.com/cmd/server",
+			}))
+		})
+
+		It("follows imports through packages that aren't being sorted", func() {
+			Expect(subject.Sort([]string{
+				"example.com/api",
+				"example.com/internal/db",
+			})).To(Equal([]string{
+				"example.com/internal/db",
+				"example.com/api",
+			}))
+		})
+
+		It("orders unrelated packages lexically", func() {
+			Expect(subject.Sort([]string{"b", "c", "a"})).To(Equal([]string{"a", "b", "c"}))
+		})
+
+		It("doesn't loop on import cycles", func() {
+			subject.Set("example.com/internal/db", []string{"example.com/api"})
+			Expect(subject.Sort([]string{
+				"example.com/api",
+				"example.com/store",
+				"example.com/internal/db",
+			})).To(HaveLen(3))
+		})
+	})
+
+	Describe("Set", func() {
+		It("replaces the previously recorded imports", func() {
+			subject.Set("example.com/api", []string{"net/http"})
+			Expect(subject.Dependents("example.com/store")).To(BeEmpty())
+		})
+	})
+
+	Describe("Remove", func() {
+		It("removes the package's edges", func() {
+			subject.Remove("example.com/store")
+			Expect(subject.Dependents("example.com/internal/db")).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,108 @@
+package pkgwatch
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-fsnotify/fsnotify"
+)
+
+// editorTempSuffixes are the suffixes of the temporary, backup and swap files
+// written by editors while saving
+var editorTempSuffixes = []string{
+	".swp", ".swo", ".swx", // vim swap files
+	"~",            // vim and emacs backups
+	"___jb_tmp___", // jetbrains safe-write temp files
+	"___jb_old___", // jetbrains safe-write backups
+	".tmp",         // generic temp files
+}
+
+// isEditorTemp returns true if path names a temporary, backup or lock file
+// written by an editor, changes to which are never interesting.
+func isEditorTemp(path string) bool {
+	base := filepath.Base(path)
+
+	// vim checks that a directory is writable by creating a file named 4913,
+	// or 5036, 5159... if that already exists
+	if n, err := strconv.Atoi(base); err == nil && n >= 4913 && (n-4913)%123 == 0 {
+		return true
+	}
+
+	// emacs auto-save files and lock symlinks
+	if (strings.HasPrefix(base, "#") && strings.HasSuffix(base, "#")) || strings.HasPrefix(base, ".#") {
+		return true
+	}
+
+	for _, suffix := range editorTempSuffixes {
+		if strings.HasSuffix(base, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// removal is a remove or rename event whose processing is deferred until the
+// end of the debounce window, in case the file is replaced within it
+type removal struct {
+	event fsnotify.Event
+	at    time.Time
+}
+
+// processEvent normalizes the events produced by editors saving a file before
+// processing them.  Editors commonly save by renaming a new file into place,
+// or by moving the old file aside and writing a new one, so removals are held
+// back until the end of the debounce window, and a file that is created in
+// place of an existing or removed file counts as written.
+func (w *Watcher) processEvent(event fsnotify.Event) {
+	now := w.clock.Now()
+
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && event.Op&fsnotify.Create == 0 {
+		w.removals[event.Name] = removal{event: event, at: now}
+		return
+	}
+
+	if event.Op&fsnotify.Create != 0 {
+		_, removed := w.removals[event.Name]
+		_, existed := w.files[event.Name]
+		if removed || existed {
+			delete(w.removals, event.Name)
+			event.Op = event.Op&^fsnotify.Create | fsnotify.Write
+		}
+	}
+
+	w.recordFile(event.Name)
+	if _, exists := w.files[event.Name]; exists {
+		w.trackGoFile(event.Name, true)
+	}
+	w.processFileEvent(event, now)
+}
+
+// flushRemovals processes the removals that weren't followed by the file being
+// replaced, then checks whether the affected packages still exist.
+func (w *Watcher) flushRemovals() {
+	affected := map[string]bool{}
+
+	for name, r := range w.removals {
+		delete(w.files, name)
+		w.processFileEvent(r.event, r.at)
+
+		if filepath.Ext(name) == ".go" {
+			affected[filepath.Dir(name)] = true
+		}
+
+		if w.watched[name] {
+			for dir := range w.packages {
+				if isUnderAny(dir, []string{name}) {
+					affected[dir] = true
+				}
+			}
+			w.unwatch(name)
+		}
+	}
+
+	w.settlePackages(affected)
+	w.removals = make(map[string]removal)
+	w.created = nil
+}
@@ -0,0 +1,190 @@
+package pkgwatch
+
+import (
+	"path/filepath"
+)
+
+// watchedPackage records the names of the go files in a package directory, so
+// that a package that disappears can be recognized should it reappear
+// elsewhere.
+type watchedPackage struct {
+	// Pkg is the import path of the package, once it has been resolved
+	Pkg   string
+	Files map[string]bool
+}
+
+// trackGoFile records that the go file at path exists.  Packages first seen
+// after the initial walk are noted as fresh, making them candidates for the
+// new location of a package that was moved.
+func (w *Watcher) trackGoFile(path string, fresh bool) {
+	if filepath.Ext(path) != ".go" {
+		return
+	}
+
+	dir := filepath.Dir(path)
+	p, ok := w.packages[dir]
+	if !ok {
+		p = &watchedPackage{Files: map[string]bool{}}
+		w.packages[dir] = p
+		if fresh {
+			w.fresh[dir] = true
+		}
+	}
+	p.Files[filepath.Base(path)] = true
+}
+
+// settlePackages checks whether the packages in the provided directories, which
+// have had files or directories removed, still exist.  Packages that no longer
+// exist are emitted as removed, or as renamed when a package with the same go
+// files appeared during the same debounce window.
+func (w *Watcher) settlePackages(dirs map[string]bool) {
+	defer func() {
+		w.fresh = make(map[string]bool)
+	}()
+
+	for dir := range dirs {
+		p, ok := w.packages[dir]
+		if !ok {
+			continue
+		}
+
+		if hasGoFiles(dir) {
+			for name := range p.Files {
+				if _, exists := w.files[filepath.Join(dir, name)]; !exists {
+					delete(p.Files, name)
+				}
+			}
+			continue
+		}
+
+		delete(w.packages, dir)
+		delete(w.embeds, dir)
+
+		pkg := p.Pkg
+		if pkg == "" {
+			if pkg, ok = w.findPackage(dir); !ok {
+				continue
+			}
+		}
+
+		// the removed files are recorded against the package's old import path
+		stale, hasStale := w.pending[pkg]
+		if hasStale && stale.Dir != dir {
+			hasStale = false
+		}
+
+		var change *Change
+		if newDir, renamed := w.findRenamed(p); renamed {
+			newPkg, found := w.findPackage(newDir)
+			if !found {
+				continue
+			}
+			delete(w.fresh, newDir)
+
+			if hasStale {
+				delete(w.pending, pkg)
+			}
+
+			change = w.addPending(newPkg, newDir)
+			change.Kind = PackageRenamed
+			change.OldPkg = pkg
+			change.OldDir = dir
+		} else {
+			change = w.addPending(pkg, dir)
+			change.Kind = PackageRemoved
+		}
+
+		if hasStale && stale != change {
+			change.Merge(stale)
+		}
+		if change.First.IsZero() {
+			now := w.clock.Now()
+			change.First, change.Last = now, now
+		}
+	}
+}
+
+// findRenamed returns the directory of a fresh package with the same go files
+// as the provided package
+func (w *Watcher) findRenamed(p *watchedPackage) (string, bool) {
+	if len(p.Files) == 0 {
+		return "", false
+	}
+
+	for dir := range w.fresh {
+		candidate := w.packages[dir]
+		if candidate == nil || len(candidate.Files) != len(p.Files) {
+			continue
+		}
+
+		same := true
+		for name := range p.Files {
+			if !candidate.Files[name] {
+				same = false
+				break
+			}
+		}
+
+		if same {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// unwatch stops watching dir, which no longer exists, and the directories
+// underneath it, forgetting what was recorded about their files so that they
+// count as new should they reappear.  Since moving a directory moves its
+// native watches along with it, the directories created during the debounce
+// window are watched anew.
+func (w *Watcher) unwatch(dir string) {
+	under := []string{dir}
+	for path := range w.files {
+		if isUnderAny(path, under) {
+			delete(w.files, path)
+		}
+	}
+	for path := range w.hashes {
+		if isUnderAny(path, under) {
+			delete(w.hashes, path)
+		}
+	}
+	for path := range w.built {
+		if isUnderAny(path, under) {
+			delete(w.built, path)
+		}
+	}
+	for path := range w.embeds {
+		if isUnderAny(path, under) {
+			delete(w.embeds, path)
+		}
+	}
+	for path, pkg := range w.graphDirs {
+		if isUnderAny(path, under) {
+			w.graph.Remove(pkg)
+			delete(w.graphDirs, path)
+		}
+	}
+
+	for watched := range w.watched {
+		if !isUnderAny(watched, []string{dir}) {
+			continue
+		}
+
+		delete(w.watched, watched)
+		w.src.Remove(watched)
+	}
+	for real, watched := range w.reals {
+		if isUnderAny(watched, under) {
+			delete(w.reals, real)
+		}
+	}
+
+	for _, created := range w.created {
+		for watched := range w.watched {
+			if isUnderAny(watched, []string{created}) {
+				w.src.Add(watched)
+			}
+		}
+	}
+}
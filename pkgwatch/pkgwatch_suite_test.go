@@ -0,0 +1,13 @@
+package pkgwatch_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPkgwatch(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pkgwatch Suite")
+}
@@ -0,0 +1,226 @@
+package pkgwatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-fsnotify/fsnotify"
+)
+
+// DefaultPollInterval is the interval used by a Watcher that falls back to
+// polling without PollInterval being set.
+var DefaultPollInterval = 1 * time.Second
+
+// PollSource is a Source that periodically lists every watched directory,
+// comparing each listing against the previous one to synthesize events.  It
+// works on any filesystem, including bind-mounted volumes and network
+// filesystems that never deliver native notifications.
+type PollSource struct {
+	interval time.Duration
+	events   chan fsnotify.Event
+	errors   chan error
+	done     chan struct{}
+	exited   chan struct{}
+
+	lock sync.Mutex
+	dirs map[string]listing
+}
+
+// fileState is the information about a file that polling compares to detect
+// changes.
+type fileState struct {
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// listing maps the names of a directory's children to their state
+type listing map[string]fileState
+
+// NewPollSource starts a PollSource that lists its directories once per
+// interval.
+func NewPollSource(interval time.Duration) *PollSource {
+	s := &PollSource{
+		interval: interval,
+		events:   make(chan fsnotify.Event, 100),
+		errors:   make(chan error, 10),
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+		dirs:     map[string]listing{},
+	}
+	go s.run()
+	return s
+}
+
+// Add starts polling dir.  Only changes made after Add returns are reported.
+func (s *PollSource) Add(dir string) error {
+	l, err := list(dir)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.dirs[dir] = l
+	s.lock.Unlock()
+	return nil
+}
+
+// Remove stops polling dir
+func (s *PollSource) Remove(dir string) error {
+	s.lock.Lock()
+	delete(s.dirs, dir)
+	s.lock.Unlock()
+	return nil
+}
+
+// Events returns the channel on which synthesized events are delivered
+func (s *PollSource) Events() <-chan fsnotify.Event {
+	return s.events
+}
+
+// Errors returns the channel on which listing failures are delivered
+func (s *PollSource) Errors() <-chan error {
+	return s.errors
+}
+
+// Close stops polling, closing the source's channels once the polling
+// goroutine has exited.
+func (s *PollSource) Close() error {
+	close(s.done)
+	<-s.exited
+	close(s.events)
+	close(s.errors)
+	return nil
+}
+
+func (s *PollSource) run() {
+	defer close(s.exited)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !s.poll() {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// poll lists every watched directory once, delivering events for any
+// differences found.  It returns false if the source was closed meanwhile.
+func (s *PollSource) poll() bool {
+	s.lock.Lock()
+	dirs := make([]string, 0, len(s.dirs))
+	for dir := range s.dirs {
+		dirs = append(dirs, dir)
+	}
+	s.lock.Unlock()
+
+	for _, dir := range dirs {
+		current, err := list(dir)
+		if os.IsNotExist(err) {
+			// the removal is reported by the listing of the parent directory
+			s.Remove(dir)
+			continue
+		}
+		if err != nil {
+			if !s.send(nil, err) {
+				return false
+			}
+			continue
+		}
+
+		s.lock.Lock()
+		previous, ok := s.dirs[dir]
+		if ok {
+			s.dirs[dir] = current
+		}
+		s.lock.Unlock()
+
+		if !ok {
+			// removed while we were listing
+			continue
+		}
+
+		for _, event := range diffListings(dir, previous, current) {
+			if !s.send(&event, nil) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// send delivers either an event or an error, returning false if the source
+// was closed before it could be delivered.
+func (s *PollSource) send(event *fsnotify.Event, err error) bool {
+	if event != nil {
+		select {
+		case s.events <- *event:
+			return true
+		case <-s.done:
+			return false
+		}
+	}
+
+	select {
+	case s.errors <- err:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// list returns the current listing of dir
+func list(dir string) (listing, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(listing, len(entries))
+	for _, entry := range entries {
+		result[entry.Name()] = fileState{
+			IsDir:   entry.IsDir(),
+			Size:    entry.Size(),
+			ModTime: entry.ModTime(),
+		}
+	}
+	return result, nil
+}
+
+// diffListings returns the events that transform the previous listing of dir
+// into the current one.
+func diffListings(dir string, previous, current listing) []fsnotify.Event {
+	var events []fsnotify.Event
+
+	for name, cur := range current {
+		path := filepath.Join(dir, name)
+		prev, existed := previous[name]
+
+		switch {
+		case !existed || prev.IsDir != cur.IsDir:
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+		case cur.IsDir:
+			// a directory's own listing reports changes to its contents
+		case prev.Size != cur.Size || !prev.ModTime.Equal(cur.ModTime):
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+
+	for name := range previous {
+		if _, exists := current[name]; !exists {
+			events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove})
+		}
+	}
+
+	return events
+}
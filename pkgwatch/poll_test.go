@@ -0,0 +1,64 @@
+package pkgwatch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-fsnotify/fsnotify"
+	. "github.com/nullstyle/mcdev/pkgwatch"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pkgwatch.PollSource", func() {
+	var (
+		subject *PollSource
+		dir     string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-poll")
+		Expect(err).To(BeNil())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package a"), 0644)).To(Succeed())
+
+		subject = NewPollSource(10 * time.Millisecond)
+		Expect(subject.Add(dir)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		subject.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("doesn't report files that existed when the directory was added", func() {
+		Consistently(subject.Events(), 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("reports created files", func() {
+		path := filepath.Join(dir, "b.go")
+		Expect(ioutil.WriteFile(path, []byte("package a"), 0644)).To(Succeed())
+		Eventually(subject.Events()).Should(Receive(Equal(fsnotify.Event{Name: path, Op: fsnotify.Create})))
+	})
+
+	It("reports written files", func() {
+		path := filepath.Join(dir, "a.go")
+		Expect(ioutil.WriteFile(path, []byte("package a\n\nvar A = 1"), 0644)).To(Succeed())
+		Eventually(subject.Events()).Should(Receive(Equal(fsnotify.Event{Name: path, Op: fsnotify.Write})))
+	})
+
+	It("reports removed files", func() {
+		path := filepath.Join(dir, "a.go")
+		Expect(os.Remove(path)).To(Succeed())
+		Eventually(subject.Events()).Should(Receive(Equal(fsnotify.Event{Name: path, Op: fsnotify.Remove})))
+	})
+
+	It("stops reporting once the directory is removed from the source", func() {
+		Expect(subject.Remove(dir)).To(Succeed())
+		Expect(os.Remove(filepath.Join(dir, "a.go"))).To(Succeed())
+		Consistently(subject.Events(), 50*time.Millisecond).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,113 @@
+package pkgwatch
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/go-fsnotify/fsnotify"
+)
+
+// ErrOverflow is reported by a Source on its Errors channel when events were
+// lost, for example because the operating system's event queue overflowed.
+// The watcher responds by rescanning everything it watches.
+var ErrOverflow = errors.New("event queue overflow")
+
+// isOverflow returns true if err signifies that the source lost events.  A
+// source may also signal lost events by delivering an event without a name.
+//
+// NOTE: the vendored fsnotify reports neither: it drops inotify's IN_Q_OVERFLOW
+// event, so an overflow of its queue goes unnoticed.
+func isOverflow(err error) bool {
+	return err == ErrOverflow
+}
+
+// stateOf returns the state of a file, as compared when rescanning
+func stateOf(stat os.FileInfo) fileState {
+	return fileState{
+		IsDir:   stat.IsDir(),
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+	}
+}
+
+// recordFile records the current state of path, forgetting it if it is no
+// longer a file.
+func (w *Watcher) recordFile(path string) {
+	stat, err := os.Lstat(path)
+	if err != nil || stat.IsDir() {
+		delete(w.files, path)
+		return
+	}
+	w.files[path] = stateOf(stat)
+}
+
+// rescanAll rescans every watched root, after the source has lost events
+func (w *Watcher) rescanAll() {
+	log.Println("events were lost, rescanning")
+	for _, root := range w.roots {
+		w.rescan(root)
+	}
+}
+
+// rescan walks the tree underneath root, watching any directories that aren't
+// yet watched and processing events for every file that was created, changed
+// or removed according to the last recorded state of the tree.  It is used
+// both to recover from lost events and to pick up the contents of a newly
+// created directory that were written before the directory was watched.
+func (w *Watcher) rescan(root string) {
+	var events []fsnotify.Event
+	seen := map[string]bool{}
+
+	w.walk(root, func(path string, stat os.FileInfo, err error) error {
+		if err != nil {
+			if !os.IsNotExist(err) {
+				w.report(&Error{Op: WalkOp, Path: path, Err: err})
+			}
+			return nil
+		}
+
+		if stat.IsDir() {
+			if w.watched[path] {
+				return nil
+			}
+
+			err = w.AddPath(path)
+			if err == filepath.SkipDir {
+				return err
+			}
+			if err != nil {
+				w.report(&Error{Op: WatchOp, Path: path, Err: err})
+				return filepath.SkipDir
+			}
+
+			w.updateGraph(path)
+			w.updateEmbeds(path)
+			return nil
+		}
+
+		seen[path] = true
+		previous, known := w.files[path]
+		switch {
+		case !known:
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+		case previous != stateOf(stat):
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+		return nil
+	})
+
+	for path := range w.files {
+		if !seen[path] && isUnderAny(path, []string{root}) {
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+		}
+	}
+
+	for _, event := range events {
+		if isEditorTemp(event.Name) {
+			continue
+		}
+		w.processEvent(event)
+	}
+}
@@ -0,0 +1,72 @@
+package pkgwatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Watcher.findPackage", func() {
+	var (
+		subject *Watcher
+		dir     string
+		saved   []string
+	)
+
+	mkdir := func(rel string) string {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		Expect(os.MkdirAll(path, 0755)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-resolve")
+		Expect(err).To(BeNil())
+		dir, err = filepath.EvalSymlinks(dir)
+		Expect(err).To(BeNil())
+
+		saved = gopath
+		gopath = []string{dir}
+		subject = &Watcher{Dir: dir}
+	})
+
+	AfterEach(func() {
+		gopath = saved
+		os.RemoveAll(dir)
+	})
+
+	It("resolves packages relative to the GOPATH's src directory", func() {
+		pkg, found := subject.findPackage(mkdir("src/github.com/nullstyle/mcdev"))
+		Expect(found).To(BeTrue())
+		Expect(pkg).To(Equal("github.com/nullstyle/mcdev"))
+	})
+
+	It("prefers the enclosing module over the GOPATH", func() {
+		modDir := mkdir("src/github.com/nullstyle/mcdev")
+		Expect(ioutil.WriteFile(filepath.Join(modDir, "go.mod"), []byte("module example.com/mcdev\n"), 0644)).To(Succeed())
+
+		pkg, found := subject.findPackage(mkdir("src/github.com/nullstyle/mcdev/pkgwatch"))
+		Expect(found).To(BeTrue())
+		Expect(pkg).To(Equal("example.com/mcdev/pkgwatch"))
+	})
+
+	It("resolves packages relative to the project's src directory in gb mode", func() {
+		gopath = nil
+		subject.IsGB = true
+
+		pkg, found := subject.findPackage(mkdir("src/server/handlers"))
+		Expect(found).To(BeTrue())
+		Expect(pkg).To(Equal("server/handlers"))
+	})
+
+	It("doesn't resolve directories outside of a module or the GOPATH", func() {
+		gopath = nil
+
+		_, found := subject.findPackage(mkdir("elsewhere"))
+		Expect(found).To(BeFalse())
+	})
+})
@@ -0,0 +1,49 @@
+package pkgwatch
+
+import (
+	"errors"
+
+	"github.com/go-fsnotify/fsnotify"
+)
+
+// ErrSourceClosed is returned by Watcher.Run when its Source closes its
+// channels while the watcher is still running
+var ErrSourceClosed = errors.New("pkgwatch: event source closed")
+
+// Source is a source of filesystem events for a Watcher.  Like fsnotify, a
+// source watches individual directories: it reports changes to a watched
+// directory's immediate children, and is told about each sub-directory to be
+// watched separately.
+type Source interface {
+	// Add starts watching the provided directory
+	Add(dir string) error
+	// Remove stops watching the provided directory
+	Remove(dir string) error
+	// Events returns the channel on which filesystem events are delivered
+	Events() <-chan fsnotify.Event
+	// Errors returns the channel on which failures are delivered
+	Errors() <-chan error
+	// Close stops the source, closing its channels
+	Close() error
+}
+
+// NewNotifySource returns a Source backed by the operating system's native
+// filesystem notifications (e.g. inotify on linux), via fsnotify.
+func NewNotifySource() (Source, error) {
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &notifySource{fs: fs}, nil
+}
+
+// notifySource adapts *fsnotify.Watcher to the Source interface
+type notifySource struct {
+	fs *fsnotify.Watcher
+}
+
+func (s *notifySource) Add(dir string) error          { return s.fs.Add(dir) }
+func (s *notifySource) Remove(dir string) error       { return s.fs.Remove(dir) }
+func (s *notifySource) Events() <-chan fsnotify.Event { return s.fs.Events }
+func (s *notifySource) Errors() <-chan error          { return s.fs.Errors }
+func (s *notifySource) Close() error                  { return s.fs.Close() }
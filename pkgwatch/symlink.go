@@ -0,0 +1,77 @@
+package pkgwatch
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// walk calls fn for root and everything underneath it, like filepath.Walk.
+// When the watcher follows symlinks, symlinks to directories are walked as
+// though they were the directories themselves.  fn must return
+// filepath.SkipDir for directories that are already watched under another
+// path, as AddPath does, so that cycles terminate.
+func (w *Watcher) walk(root string, fn filepath.WalkFunc) {
+	if !w.FollowSymlinks {
+		filepath.Walk(root, fn)
+		return
+	}
+
+	stat, err := os.Stat(root)
+	w.walkFollowing(root, stat, err, fn)
+}
+
+func (w *Watcher) walkFollowing(path string, stat os.FileInfo, err error, fn filepath.WalkFunc) {
+	if err != nil {
+		fn(path, stat, err)
+		return
+	}
+
+	if !stat.IsDir() {
+		fn(path, stat, nil)
+		return
+	}
+
+	if fn(path, stat, nil) != nil {
+		return
+	}
+
+	names, err := readDirNames(path)
+	if err != nil {
+		fn(path, stat, err)
+		return
+	}
+
+	for _, name := range names {
+		child := filepath.Join(path, name)
+
+		// broken symlinks are reported as the links themselves
+		childStat, err := os.Stat(child)
+		if err != nil {
+			childStat, err = os.Lstat(child)
+		}
+		w.walkFollowing(child, childStat, err, fn)
+	}
+}
+
+// readDirNames returns the sorted names of the entries of dir
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isSymlink returns true if path is a symbolic link
+func isSymlink(path string) bool {
+	stat, err := os.Lstat(path)
+	return err == nil && stat.Mode()&os.ModeSymlink != 0
+}
@@ -1,27 +1,154 @@
 package pkgwatch
 
 import (
+	"context"
 	"fmt"
+	"go/build"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-fsnotify/fsnotify"
+	"github.com/nullstyle/mcdev/gitignore"
+	"github.com/nullstyle/mcdev/gomod"
 )
 
 // Watcher watches for go package changes underneath a directory and emits
-// their names as go files within them change
+// a Change (or just the package's name, see Changes()) as go files within
+// them change
+//
+// When Dependents is true, the watcher maintains an import graph of the
+// watched packages and also emits every package that transitively imports a
+// changed package.  TrackImports maintains the graph without emitting
+// dependents.  Either way, the changes emitted together are emitted in
+// dependency order, each after the changed packages it imports.
+//
+// Filesystem events are read from Source, which defaults to native
+// notifications.  The watcher takes ownership of the source, closing it once
+// the watcher stops.  When PollInterval is non-zero a PollSource is used
+// instead, and the watcher automatically falls back to polling if the native
+// watch limit is exhausted (e.g. inotify's max_user_watches).
+//
+// Changes are debounced: by default, they are emitted once no events have been
+// received for the Debounce duration.  With the LeadingDebounce mode, the first
+// change of a burst of events is emitted immediately instead, and the changes
+// that follow it once the burst is over.  When MaxWait is non-zero, pending
+// changes are emitted at least once per MaxWait even while events keep
+// arriving or git is busy.
+//
+// Clock, which defaults to the system clock, times the debounce.
+//
+// When SkipUnchanged is true, the watcher keeps a hash of every watched go
+// file's content and ignores events that leave the content unchanged, such as
+// an editor re-saving a file.  IgnoreFormatting extends this to changes that
+// only affect comments or formatting.
+//
+// Which files and directories are watched is controlled by glob patterns, see
+// matchAny for their syntax.  Changes to files matching IncludeFiles (by
+// default, go files) but not ExcludeFiles are processed, and directories
+// matching ExcludeDirs (by default, hidden and vendor directories) are not
+// watched unless they also match IncludeDirs.  Changes to files other than go
+// files are attributed to the package of their nearest ancestor directory
+// containing go files, and changes within testdata directories to the package
+// containing the testdata directory.
+//
+// When GitIgnore is set, files and directories ignored by git are excluded
+// too, as determined by the repository's .gitignore files and
+// .git/info/exclude.
+//
+// The watcher also reads the //go:embed directives of the watched packages, and
+// changes to a file embedded by a package are attributed to that package even
+// if the file doesn't match IncludeFiles.
+//
+// If Build is set, changes to go files that are excluded from builds using
+// that context by their build constraints--their GOOS and GOARCH suffixes and
+// //go:build lines--are ignored; see NewBuildContext.
+//
+// Besides Dir, the watcher watches each of Roots, the modules of the go.work
+// file found in Dir or its parents, and the directories named by the local
+// replace directives (e.g. `replace example.com/lib => ../lib`) of Dir's
+// go.mod.  Symbolic links to directories are only followed when FollowSymlinks
+// is set, in which case a directory reachable by more than one path is watched
+// once.
+//
+// A package whose directory is removed, or whose last go file is, is emitted
+// as a Change of the PackageRemoved kind.  If a package with the same go files
+// appears elsewhere during the same debounce window, such as when a package
+// directory is moved, a single PackageRenamed change is emitted for the new
+// location instead.
+//
+// Changes to a module's go.mod or go.sum are emitted as a single Change of the
+// ModuleChanged kind, rather than as changes to the module's packages.
+//
+// When more than BurstThreshold packages change within one debounce window,
+// such as when switching branches, a single Change of the ManyChanged kind is
+// emitted in their place.  If PauseForGit is set, the watcher waits while git
+// is rewriting the working tree--during a checkout, merge or rebase--before
+// emitting, and then combines everything that changed in the meantime into a
+// single Change as well.  Removed packages and module changes are never
+// combined, and are still emitted separately.  A rebase stopped for a conflict or an edit doesn't
+// count, and the watcher waits no longer than MaxWait, or 10 seconds without
+// one, in case git crashed and left its lock file behind.
+//
+// When Batch is set, the changed and renamed packages of each debounce window
+// are combined into a single Change of the ManyChanged kind, even if only one
+// package changed.
 type Watcher struct {
-	Dir      string
-	Debounce time.Duration
-	IsGB     bool
-	inited   bool
-	fs       *fsnotify.Watcher
-	changes  chan string
-	done     chan bool
-	pending  map[string]bool
+	Dir              string
+	Debounce         time.Duration
+	IsGB             bool
+	Dependents       bool
+	TrackImports     bool
+	Source           Source
+	PollInterval     time.Duration
+	Clock            Clock
+	SkipUnchanged    bool
+	IgnoreFormatting bool
+	IncludeFiles     []string
+	ExcludeFiles     []string
+	IncludeDirs      []string
+	ExcludeDirs      []string
+	Build            *build.Context
+	Roots            []string
+	FollowSymlinks   bool
+	GitIgnore        bool
+	DebounceMode     DebounceMode
+	MaxWait          time.Duration
+	BurstThreshold   int
+	PauseForGit      bool
+	Batch            bool
+	inited           bool
+	hashes           map[string]digest
+	clock            Clock
+	src              Source
+	watched          map[string]bool
+	reals            map[string]string
+	events           chan Change
+	changes          chan string
+	errors           chan error
+	adapt            sync.Once
+	adapted          chan struct{}
+	done             chan struct{}
+	pending          map[string]*Change
+	roots            []string
+	graph            *Graph
+	graphDirs        map[string]string
+	embeds           map[string][]string
+	built            map[string]bool
+	gitDirs          []string
+	paused           bool
+	pausedAt         time.Time
+	gitStale         bool
+	files            map[string]fileState
+	removals         map[string]removal
+	ignores          []*gitignore.Matcher
+	packages         map[string]*watchedPackage
+	fresh            map[string]bool
+	created          []string
 }
 
 // Init ensures the internal state of the watcher is properly initialized
@@ -30,11 +157,6 @@ func (w *Watcher) Init() (err error) {
 		return nil
 	}
 
-	w.fs, err = fsnotify.NewWatcher()
-	if err != nil {
-		return
-	}
-
 	stat, err := os.Stat(w.Dir)
 	if err != nil {
 		return
@@ -45,153 +167,636 @@ func (w *Watcher) Init() (err error) {
 		return
 	}
 
-	w.changes = make(chan string, 100)
-	w.done = make(chan bool, 1)
-	w.pending = make(map[string]bool)
+	w.roots, err = w.findRoots()
+	if err != nil {
+		return
+	}
+
+	switch {
+	case w.Source != nil:
+		w.src = w.Source
+	case w.PollInterval > 0:
+		w.src = NewPollSource(w.PollInterval)
+	default:
+		w.src, err = NewNotifySource()
+		if err != nil {
+			return
+		}
+	}
+
+	w.clock = w.Clock
+	if w.clock == nil {
+		w.clock = realClock{}
+	}
+
+	w.events = make(chan Change, 100)
+	w.errors = make(chan error, 10)
+	w.done = make(chan struct{})
+	w.watched = make(map[string]bool)
+	w.reals = make(map[string]string)
+	w.hashes = make(map[string]digest)
+	w.pending = make(map[string]*Change)
+	w.graph = NewGraph()
+	w.graphDirs = make(map[string]string)
+	w.embeds = make(map[string][]string)
+	w.built = make(map[string]bool)
+	w.files = make(map[string]fileState)
+	w.removals = make(map[string]removal)
+	w.packages = make(map[string]*watchedPackage)
+	w.fresh = make(map[string]bool)
+	if w.PauseForGit {
+		w.gitDirs = findGitDirs(w.roots)
+	}
+	if w.GitIgnore {
+		w.ignores = newIgnoreMatchers(w.roots)
+	}
 	w.inited = true
 	return
 }
 
 // Run runs the watcher, continually pushing events from the fs watcher to
-// the changes channel.
-func (w *Watcher) Run() error {
+// the events channel until ctx is cancelled, or until the Source closes its
+// channels, in which case Run returns ErrSourceClosed.  Once stopped, the
+// watcher stops watching, closes the channels returned by Events(), Changes()
+// and Errors(), and returns after all of its goroutines have exited.
+//
+// Callers that need the watcher's channels before starting it in its own
+// goroutine should call Init() first.
+func (w *Watcher) Run(ctx context.Context) error {
 	if err := w.Init(); err != nil {
 		return err
 	}
+	defer w.teardown()
 
-	baseDir := w.Dir
-	if w.IsGB {
-		baseDir = filepath.Join(baseDir, "src")
+	// initialize the watchlist
+	for _, root := range w.roots {
+		w.walk(root, func(path string, stat os.FileInfo, err error) error {
+
+			if err != nil {
+				// whatever failed is skipped, the rest of the tree is still watched
+				w.report(&Error{Op: WalkOp, Path: path, Err: err})
+				return nil
+			}
+
+			if !stat.IsDir() {
+				w.recordDigest(path)
+				w.recordBuilt(path)
+				w.files[path] = stateOf(stat)
+				w.trackGoFile(path, false)
+				return nil
+			}
+
+			err = w.AddPath(path)
+			if err == filepath.SkipDir {
+				return err
+			}
+			if err != nil {
+				w.report(&Error{Op: WatchOp, Path: path, Err: err})
+				return filepath.SkipDir
+			}
+
+			w.updateGraph(path)
+			w.updateEmbeds(path)
+			return nil
+		})
 	}
 
-	// initialize the watchlist
-	err := filepath.Walk(baseDir, func(path string, stat os.FileInfo, err error) error {
+	// debounce fires once no events have been received for the Debounce
+	// duration, and is nil while there is nothing to emit.  maxWait fires
+	// MaxWait after the first event that debounce is waiting on.
+	var debounce, maxWait <-chan time.Time
+
+	// arm (re)starts the debounce after an event, first emitting the event's
+	// change if it is the leading edge of a burst.  Removals are left pending
+	// until the end of the window, in case the file is replaced within it.
+	arm := func() {
+		if debounce == nil && w.DebounceMode == LeadingDebounce {
+			w.release(ctx, false)
+		}
 
-		if err != nil {
-			log.Fatal(err)
+		debounce = w.clock.After(w.Debounce)
+		if maxWait == nil && w.MaxWait > 0 {
+			maxWait = w.clock.After(w.MaxWait)
 		}
+	}
 
-		if !stat.IsDir() {
+	for {
+		select {
+		case event, ok := <-w.src.Events():
+			if !ok {
+				return ErrSourceClosed
+			}
+
+			if event.Name == "" {
+				w.rescanAll()
+				arm()
+				continue
+			}
+
+			if isEditorTemp(event.Name) {
+				continue
+			}
+
+			w.processIgnoreEvent(event)
+
+			// if it's a directory add/remove it from the watchlist
+			w.processDirEvent(event)
+
+			// if it's a watched file, find what package
+			w.processEvent(event)
+
+			arm()
+
+		case err, ok := <-w.src.Errors():
+			if !ok {
+				return ErrSourceClosed
+			}
+
+			if err != nil && isOverflow(err) {
+				w.rescanAll()
+				arm()
+			} else if err != nil {
+				w.report(&Error{Op: NotifyOp, Err: err})
+			}
+		case <-debounce:
+			debounce = nil
+			if w.release(ctx, true) {
+				maxWait = nil
+			} else {
+				debounce = w.clock.After(gitPollInterval)
+			}
+		case <-maxWait:
+			// MaxWait bounds how long changes wait, even for git
+			maxWait = nil
+			w.flushRemovals()
+			w.emit(ctx)
+		case <-ctx.Done():
 			return nil
 		}
+	}
+}
 
-		return w.AddPath(path)
-	})
+// release emits the pending changes, after processing the pending removals if
+// flush is set, unless git is rewriting the working tree in which case it
+// returns false and the changes remain pending.
+func (w *Watcher) release(ctx context.Context, flush bool) bool {
+	if flush {
+		w.flushRemovals()
+	}
+	if w.waitForGit() {
+		return false
+	}
 
+	w.emit(ctx)
+	return true
+}
+
+// teardown closes the event source and the watcher's channels, waiting for the
+// Changes() adapter to exit.
+func (w *Watcher) teardown() {
+	close(w.done)
+
+	err := w.src.Close()
 	if err != nil {
-		return err
+		log.Printf("warn: %v", err)
 	}
 
-	go func() {
-		for {
-			select {
-			case event := <-w.fs.Events:
-				// if it's a directory add/remove it from the watchlist
-				err = w.processDirEvent(event)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				// if it's a go file, find what package
-				err := w.processGoEvent(event)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-			case err := <-w.fs.Errors:
-				if err != nil {
-					log.Fatal(err)
-				}
-			case <-time.After(w.Debounce):
-				w.emit()
-			case <-w.done:
-				close(w.changes)
-				log.Println("closed package watcher")
-				return
-			}
-		}
-	}()
+	close(w.events)
+	close(w.errors)
 
-	return nil
+	// ensure Changes() can no longer start an adapter, then wait for the one it
+	// may have started.
+	w.adapt.Do(func() {
+		w.changes = make(chan string)
+		close(w.changes)
+	})
+	if w.adapted != nil {
+		<-w.adapted
+	}
+
+	log.Println("closed package watcher")
 }
 
-// Close closes the watcher
-func (w *Watcher) Close() error {
-	w.done <- true
-	close(w.done)
-	return w.fs.Close()
+// Events returns a channel that receives a Change everytime a package
+// underneath the watched directory changes.  It must not be called before
+// Init() or Run().
+func (w *Watcher) Events() <-chan Change {
+	return w.events
 }
 
 // Changes return a channel a message everytime a package underneath the
-// watched directory changes
+// watched directory changes.  It is a thin adapter over Events(), for callers
+// that only care about the changed package's import path; a watcher's changes
+// should be consumed from only one of the two channels.
 func (w *Watcher) Changes() <-chan string {
+	w.adapt.Do(func() {
+		w.changes = make(chan string, cap(w.events))
+		w.adapted = make(chan struct{})
+		go w.adaptChanges()
+	})
 	return w.changes
 }
 
-// AddPath adds a new directory to the watched list of directories
+// adaptChanges forwards the import path of every change to the changes
+// channel, giving up on delivery once the watcher is shutting down.
+func (w *Watcher) adaptChanges() {
+	defer close(w.adapted)
+	defer close(w.changes)
+
+	for change := range w.events {
+		select {
+		case w.changes <- change.Pkg:
+		case <-w.done:
+		}
+	}
+}
+
+// Graph returns the import graph of the watched packages.  The graph is only
+// populated when Dependents or TrackImports is true.
+func (w *Watcher) Graph() *Graph {
+	return w.graph
+}
+
+// Errors returns a channel that receives an *Error for every failure the
+// watcher encounters.  The watcher keeps running regardless, so receivers
+// should decide which errors are worth aborting for; see IsTransient().  Like
+// Events(), it must not be called before Init() or Run().
+//
+// Errors are never allowed to block the watcher: if the channel's buffer is
+// full, further errors are logged instead.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// AddPath adds a new directory to the watched list of directories.  A
+// directory that is already watched under another path, through a symlink, is
+// skipped.
 func (w *Watcher) AddPath(path string) error {
-	base := filepath.Base(path)
-	// we don't watch hidden dirs
-	if base[0] == '.' {
+	if w.isExcludedDir(path) {
 		return filepath.SkipDir
 	}
 
-	// we don't watch vendored code for modifications (TODO: add a flag to enable/disable this)
-	if base == "vendor" {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	if watched, ok := w.reals[real]; ok && watched != path {
+		log.Printf("not watching %s again, it links to %s", path, watched)
 		return filepath.SkipDir
 	}
 
-	if err := w.fs.Add(path); err != nil {
+	err = w.src.Add(path)
+	if err == syscall.ENOSPC && w.Source == nil && w.PollInterval == 0 {
+		w.fallbackToPolling()
+		err = w.src.Add(path)
+	}
+	if err != nil {
 		return err
 	}
 
+	w.watched[path] = true
+	w.reals[real] = path
 	return nil
 }
 
-//processGoEvent takes a go package, finds out the its path relative to
-//the current GOPATH, and emits it on the changes channel
-func (w *Watcher) processGoEvent(event fsnotify.Event) error {
-	goPath := event.Name
+// fallbackToPolling replaces the native event source with a PollSource,
+// watching every directory watched so far.
+func (w *Watcher) fallbackToPolling() {
+	log.Println("warn: native watch limit reached, falling back to polling")
 
-	if filepath.Ext(goPath) != ".go" {
+	poll := NewPollSource(DefaultPollInterval)
+	for dir := range w.watched {
+		if err := poll.Add(dir); err != nil {
+			w.report(&Error{Op: WatchOp, Path: dir, Err: err})
+		}
+	}
+
+	if err := w.src.Close(); err != nil {
+		log.Printf("warn: %v", err)
+	}
+	w.src = poll
+}
+
+// processFileEvent takes a changed file, finds out the import paths of the
+// packages it affects, and marks those packages as pending
+func (w *Watcher) processFileEvent(event fsnotify.Event, at time.Time) {
+	path := event.Name
+
+	if isModuleFile(path) {
+		w.processModuleEvent(event, at)
+		return
+	}
+
+	included := w.isIncludedFile(path) && !w.isConstrained(event)
+	dirs := w.embedders(path)
+	if !included && len(dirs) == 0 {
+		return
+	}
+
+	if w.isUnchanged(event) {
+		return
+	}
+
+	if included {
+		if dir, found := w.packageDir(path); found {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		pkg, found := w.findPackage(dir)
+		if !found {
+			log.Printf("couldn't find package for %s", filepath.Base(path))
+			continue
+		}
+
+		w.addPending(pkg, dir).add(event, at)
+		if p := w.packages[dir]; p != nil {
+			p.Pkg = pkg
+		}
+	}
+
+	if filepath.Ext(path) == ".go" {
+		dir := filepath.Dir(path)
+		w.updateGraph(dir)
+		w.updateEmbeds(dir)
+	}
+}
+
+// processModuleEvent marks the module whose go.mod or go.sum changed as
+// pending
+func (w *Watcher) processModuleEvent(event fsnotify.Event, at time.Time) {
+	if w.isExcludedFile(event.Name) || w.isUnchanged(event) {
+		return
+	}
+
+	dir := filepath.Dir(event.Name)
+	mod, err := gomod.Load(dir)
+	if err != nil {
+		// a removed go.mod leaves the packages of the directory to be resolved
+		// from their parents, and a go.mod being edited may not be complete yet.
+		if !os.IsNotExist(err) {
+			log.Printf("warn: %v", err)
+		}
+		return
+	}
+
+	change := w.addPending(mod.Path+"/...", dir)
+	change.Kind = ModuleChanged
+	change.Module = mod.Path
+	change.add(event, at)
+}
+
+// updateEmbeds re-reads the //go:embed patterns of the package in dir
+func (w *Watcher) updateEmbeds(dir string) {
+	patterns, err := parseEmbeds(dir)
+	if err != nil {
+		w.report(&Error{Op: ResolveOp, Path: dir, Err: err})
+		return
+	}
+
+	if len(patterns) == 0 {
+		delete(w.embeds, dir)
+		return
+	}
+	w.embeds[dir] = patterns
+}
+
+// embedders returns the directories of the packages that embed file, searching
+// each of its parent directories within the watched roots.
+func (w *Watcher) embedders(file string) []string {
+	if len(w.embeds) == 0 || !isUnderAny(file, w.roots) || w.isExcludedFile(file) {
 		return nil
 	}
-	dir := filepath.Dir(goPath)
-	pkg, found := w.findPackage(dir)
 
+	var dirs []string
+	dir := filepath.Dir(file)
+	for {
+		rel := filepath.ToSlash(file[len(dir)+1:])
+		for _, pattern := range w.embeds[dir] {
+			if matchEmbed(pattern, rel) {
+				dirs = append(dirs, dir)
+				break
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if w.isRoot(dir) || parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
+}
+
+// updateGraph re-parses the imports of the package in dir, updating the
+// import graph.  It is a no-op unless the watcher is tracking imports.
+func (w *Watcher) updateGraph(dir string) {
+	if !w.Dependents && !w.TrackImports {
+		return
+	}
+
+	imports, hasGo, err := parseImports(dir)
+	if err != nil {
+		w.report(&Error{Op: ResolveOp, Path: dir, Err: err})
+		return
+	}
+
+	if !hasGo {
+		if pkg, ok := w.graphDirs[dir]; ok {
+			w.graph.Remove(pkg)
+			delete(w.graphDirs, dir)
+		}
+		return
+	}
+
+	pkg, found := w.findPackage(dir)
 	if !found {
-		log.Printf("couldn't find package for %s", filepath.Base(goPath))
-		return nil
+		return
 	}
 
-	w.addPending(pkg)
-	return nil
+	w.graph.Set(pkg, imports)
+	w.graphDirs[dir] = pkg
 }
 
-func (w *Watcher) processDirEvent(event fsnotify.Event) error {
+func (w *Watcher) processDirEvent(event fsnotify.Event) {
 	// if not a create event, return
 	if event.Op&fsnotify.Create != fsnotify.Create {
-		return nil
+		return
 	}
 
 	stat, err := os.Stat(event.Name)
 	if os.IsNotExist(err) {
-		return nil
+		return
 	}
 
 	if err != nil {
-		log.Printf("failed stating: %s", event.Name)
-		return err
+		w.report(&Error{Op: StatOp, Path: event.Name, Err: err})
+		return
 	}
 
 	if !stat.IsDir() {
-		return nil
+		return
+	}
+
+	if !w.FollowSymlinks && isSymlink(event.Name) {
+		return
+	}
+
+	err = w.AddPath(event.Name)
+	if err == filepath.SkipDir {
+		return
+	}
+	if err != nil {
+		w.report(&Error{Op: WatchOp, Path: event.Name, Err: err})
+		return
 	}
 
-	return w.AddPath(event.Name)
+	w.created = append(w.created, event.Name)
+
+	// files may have been written into the directory, or directories created
+	// within it, before it was watched
+	w.rescan(event.Name)
 }
 
+// isUnchanged returns true if the event left the content of the file it names
+// unchanged, updating the file's recorded digest.  It is always false unless
+// SkipUnchanged is set.
+func (w *Watcher) isUnchanged(event fsnotify.Event) bool {
+	if !w.SkipUnchanged {
+		return false
+	}
+
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		delete(w.hashes, event.Name)
+		return false
+	}
+
+	previous, seen := w.hashes[event.Name]
+	if !w.recordDigest(event.Name) {
+		return false
+	}
+
+	return seen && w.hashes[event.Name] == previous
+}
+
+// recordDigest hashes the go file at path, returning false if it couldn't be
+// hashed.
+func (w *Watcher) recordDigest(path string) bool {
+	isGo := filepath.Ext(path) == ".go"
+	if !w.SkipUnchanged || !(isGo || isModuleFile(path)) {
+		return false
+	}
+
+	sum, err := digestFile(path, isGo && w.IgnoreFormatting)
+	if err != nil {
+		delete(w.hashes, path)
+		return false
+	}
+
+	w.hashes[path] = sum
+	return true
+}
+
+// report delivers err on the errors channel, without blocking.
+func (w *Watcher) report(err error) {
+	select {
+	case w.errors <- err:
+	default:
+		log.Printf("warn: %v", err)
+	}
+}
+
+// findRoots returns the directories to recursively watch.  Normally that is
+// just Dir (or its "src" directory in gb mode), but when Dir is part of a go
+// workspace each of the workspace's modules is watched as well.
+func (w *Watcher) findRoots() ([]string, error) {
+	baseDir := w.Dir
+	if w.IsGB {
+		baseDir = filepath.Join(baseDir, "src")
+	}
+	roots := []string{baseDir}
+
+	for _, root := range w.Roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+
+		stat, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", root)
+		}
+		roots = addRoot(roots, root)
+	}
+
+	ws, err := gomod.FindWorkspace(w.Dir)
+	switch err {
+	case nil:
+		for _, use := range ws.Uses {
+			roots = addRoot(roots, use)
+		}
+	case gomod.ErrNoWorkspace:
+	default:
+		return nil, err
+	}
+
+	mod, err := gomod.Find(w.Dir)
+	switch err {
+	case nil:
+		for _, dir := range mod.LocalReplaces() {
+			if _, err := os.Stat(dir); err != nil {
+				log.Printf("warn: not watching replacement: %v", err)
+				continue
+			}
+			roots = addRoot(roots, dir)
+		}
+	case gomod.ErrNotFound:
+	default:
+		log.Printf("warn: %v", err)
+	}
+
+	return roots, nil
+}
+
+// addRoot adds dir to roots unless it is underneath one of them, removing any
+// of the roots that are underneath dir.
+func addRoot(roots []string, dir string) []string {
+	if isUnderAny(dir, roots) {
+		return roots
+	}
+
+	result := roots[:0]
+	for _, root := range roots {
+		if !isUnderAny(root, []string{dir}) {
+			result = append(result, root)
+		}
+	}
+	return append(result, dir)
+}
+
+// findPackage resolves the import path of the package in dir.  The enclosing
+// go module is preferred, falling back to the gb project layout or the GOPATH
+// when dir isn't part of a module.
 func (w *Watcher) findPackage(dir string) (string, bool) {
+	mod, err := gomod.Find(dir)
+	switch err {
+	case nil:
+		return mod.ImportPath(dir)
+	case gomod.ErrNotFound:
+		// not in a module, use the gb/GOPATH logic below
+	default:
+		w.report(&Error{Op: ResolveOp, Path: dir, Err: err})
+	}
+
 	var foundRoot string
 
 	if w.IsGB {
@@ -201,7 +806,7 @@ func (w *Watcher) findPackage(dir string) (string, bool) {
 		foundRoot, foundOnGoPath = isOnGoPath(dir)
 
 		if !foundOnGoPath {
-			log.Printf("warn: changed file was not found on a local gopath. ignoring...")
+			log.Printf("warn: changed file was not found in a module or on a local gopath. ignoring...")
 			return "", false
 		}
 	}
@@ -210,27 +815,95 @@ func (w *Watcher) findPackage(dir string) (string, bool) {
 
 	// ASSERT: the changed directory is underneath the found gopath entry's "src"
 	// directory
-	if !strings.HasPrefix(dir, srcRoot) {
-		log.Fatalf("%s isn't underneath %s, "+
-			"even though it was found with isOnGoPath",
-			dir,
-			srcRoot)
+	if !strings.HasPrefix(dir, srcRoot+string(filepath.Separator)) {
+		w.report(&Error{
+			Op:   ResolveOp,
+			Path: dir,
+			Err:  fmt.Errorf("not underneath %s, even though it was found with isOnGoPath", srcRoot),
+		})
+		return "", false
 	}
 
 	return dir[len(srcRoot)+1:], true
 }
 
-func (w *Watcher) emit() {
+func (w *Watcher) emit(ctx context.Context) {
 	if len(w.pending) == 0 {
 		return
 	}
 
+	if w.Dependents {
+		var dependents []string
+		for pkg := range w.pending {
+			dependents = append(dependents, w.graph.Dependents(pkg)...)
+		}
+
+		for _, pkg := range dependents {
+			w.addPending(pkg, w.graphDir(pkg))
+		}
+	}
+
+	burst := w.BurstThreshold > 0 && len(w.pending) > w.BurstThreshold
+	combine := w.Batch || burst || (w.paused && len(w.pending) > 1)
+	w.paused = false
+
+	pkgs := make([]string, 0, len(w.pending))
 	for pkg := range w.pending {
-		w.changes <- pkg
+		pkgs = append(pkgs, pkg)
+	}
+
+	changes := make([]*Change, 0, len(pkgs))
+	for _, pkg := range w.graph.Sort(pkgs) {
+		changes = append(changes, w.pending[pkg])
+	}
+	w.pending = make(map[string]*Change)
+
+	if combine {
+		changes = batch(changes)
 	}
-	w.pending = make(map[string]bool)
+
+	for _, change := range changes {
+		select {
+		case w.events <- *change:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// addPending returns the pending change for pkg, creating it if needed.
+func (w *Watcher) addPending(pkg, dir string) *Change {
+	change, ok := w.pending[pkg]
+	if !ok {
+		change = &Change{Pkg: pkg, Dir: dir}
+		w.pending[pkg] = change
+	}
+	return change
 }
 
-func (w *Watcher) addPending(pkg string) {
-	w.pending[pkg] = true
+// graphDir returns the directory of a package in the import graph
+func (w *Watcher) graphDir(pkg string) string {
+	for dir, p := range w.graphDirs {
+		if p == pkg {
+			return dir
+		}
+	}
+	return ""
+}
+
+// isModuleFile returns true if path is a go.mod or go.sum file
+func isModuleFile(path string) bool {
+	base := filepath.Base(path)
+	return base == "go.mod" || base == "go.sum"
+}
+
+// isUnderAny returns true if dir is one of, or a descendant of one of, the
+// provided parent directories.
+func isUnderAny(dir string, parents []string) bool {
+	for _, parent := range parents {
+		if dir == parent || strings.HasPrefix(dir, parent+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,1133 @@
+package pkgwatch_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-fsnotify/fsnotify"
+	. "github.com/nullstyle/mcdev/pkgwatch"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pkgwatch.Watcher with a fake source and clock", func() {
+	var (
+		subject  *Watcher
+		source   *FakeSource
+		clock    *FakeClock
+		dir      string
+		cancel   context.CancelFunc
+		finished chan bool
+		runErr   error
+		start    = time.Unix(1000, 0)
+		debounce = 500 * time.Millisecond
+	)
+
+	path := func(rel string) string {
+		return filepath.Join(dir, filepath.FromSlash(rel))
+	}
+
+	write := func(rel, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(path(rel)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path(rel), []byte(contents), 0644)).To(Succeed())
+	}
+
+	send := func(rel string, op fsnotify.Op) {
+		source.Send(fsnotify.Event{Name: path(rel), Op: op})
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-pkgwatch-fake")
+		Expect(err).To(BeNil())
+		dir, err = filepath.EvalSymlinks(dir)
+		Expect(err).To(BeNil())
+
+		write("go.mod", "module example.com/watched\n")
+		write("store/store.go", "package store")
+		write("store/internal/db/db.go", "package db")
+		write("api/api.go", "package api")
+		write(".hidden/hidden.go", "package hidden")
+		write("vendor/example.org/dep/dep.go", "package dep")
+
+		source = NewFakeSource()
+		clock = NewFakeClock(start)
+		subject = &Watcher{
+			Dir:      dir,
+			Debounce: debounce,
+			Source:   source,
+			Clock:    clock,
+		}
+	})
+
+	JustBeforeEach(func() {
+		Expect(subject.Init()).To(Succeed())
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		finished = make(chan bool)
+		go func(subject *Watcher, finished chan bool) {
+			defer close(finished)
+			runErr = subject.Run(ctx)
+		}(subject, finished)
+
+		// the watcher only receives from its source once the initial walk of the
+		// watched directory is complete
+		source.SendError(errors.New("walk complete"))
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(finished).Should(BeClosed())
+		os.RemoveAll(dir)
+	})
+
+	// advance waits until the watcher has armed the expected number of
+	// timers, then advances the clock.
+	advance := func(waiters int, d time.Duration) {
+		Eventually(clock.Waiters).Should(Equal(waiters))
+		clock.Advance(d)
+	}
+
+	Describe("watching", func() {
+		It("watches every directory except hidden and vendored ones", func() {
+			Eventually(source.Watched).Should(Equal([]string{
+				dir,
+				path("api"),
+				path("store"),
+				path("store/internal"),
+				path("store/internal/db"),
+			}))
+		})
+
+		It("watches newly created directories", func() {
+			write("cmd/server/main.go", "package main")
+			send("cmd", fsnotify.Create)
+			Eventually(source.Watched).Should(ContainElement(path("cmd")))
+		})
+
+		It("doesn't watch newly created hidden or vendor directories", func() {
+			Expect(os.MkdirAll(path(".git"), 0755)).To(Succeed())
+			Expect(os.MkdirAll(path("api/vendor"), 0755)).To(Succeed())
+			send(".git", fsnotify.Create)
+			send("api/vendor", fsnotify.Create)
+			Consistently(source.Watched).ShouldNot(ContainElement(path(".git")))
+			Consistently(source.Watched).ShouldNot(ContainElement(path("api/vendor")))
+		})
+	})
+
+	Describe("debouncing", func() {
+		It("emits nothing until the debounce elapses", func() {
+			send("store/store.go", fsnotify.Write)
+			advance(1, debounce-time.Millisecond)
+			Consistently(subject.Events()).ShouldNot(Receive())
+
+			clock.Advance(time.Millisecond)
+			Eventually(subject.Events()).Should(Receive())
+		})
+
+		It("restarts the debounce on every event", func() {
+			send("store/store.go", fsnotify.Write)
+			advance(1, 300*time.Millisecond)
+			send("store/store.go", fsnotify.Write)
+			advance(2, 300*time.Millisecond)
+			Consistently(subject.Events()).ShouldNot(Receive())
+
+			clock.Advance(200 * time.Millisecond)
+			Eventually(subject.Events()).Should(Receive())
+		})
+
+		It("coalesces the events of a package into one change", func() {
+			send("store/store.go", fsnotify.Write)
+			advance(1, 100*time.Millisecond)
+			send("store/store_test.go", fsnotify.Create)
+			advance(2, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Pkg).To(Equal("example.com/watched/store"))
+			Expect(change.Dir).To(Equal(path("store")))
+			Expect(change.Files).To(Equal([]string{path("store/store.go"), path("store/store_test.go")}))
+			Expect(change.Ops).To(Equal(Op(fsnotify.Write | fsnotify.Create)))
+			Expect(change.First).To(Equal(start))
+			Expect(change.Last).To(Equal(start.Add(100 * time.Millisecond)))
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+	})
+
+	Describe("leading debounce", func() {
+		BeforeEach(func() {
+			subject.DebounceMode = LeadingDebounce
+		})
+
+		It("emits the first change immediately and the rest once quiet", func() {
+			send("store/store.go", fsnotify.Write)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Pkg).To(Equal("example.com/watched/store"))
+
+			send("api/api.go", fsnotify.Write)
+			advance(2, debounce-time.Millisecond)
+			Consistently(subject.Events()).ShouldNot(Receive())
+
+			clock.Advance(time.Millisecond)
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Pkg).To(Equal("example.com/watched/api"))
+		})
+
+		It("emits the first change of the next burst immediately", func() {
+			send("store/store.go", fsnotify.Write)
+			Eventually(subject.Events()).Should(Receive())
+			advance(1, debounce)
+
+			send("api/api.go", fsnotify.Write)
+			Eventually(subject.Events()).Should(Receive())
+		})
+
+		It("normalizes a save that renames the file aside, then writes a new one", func() {
+			Expect(os.Rename(path("store/store.go"), path("store/store.go~"))).To(Succeed())
+			send("store/store.go", fsnotify.Rename)
+			send("store/store.go~", fsnotify.Create)
+			write("store/store.go", "package store\n")
+			send("store/store.go", fsnotify.Create)
+			send("store/store.go", fsnotify.Write)
+			Consistently(subject.Events()).ShouldNot(Receive())
+
+			advance(3, debounce)
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(PackageChanged))
+			Expect(change.Pkg).To(Equal("example.com/watched/store"))
+			Expect(change.Ops).To(Equal(Op(fsnotify.Write)))
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+	})
+
+	Describe("max wait", func() {
+		BeforeEach(func() {
+			subject.MaxWait = 2 * debounce
+		})
+
+		It("emits changes while events keep arriving", func() {
+			send("store/store.go", fsnotify.Write)
+			advance(2, 400*time.Millisecond)
+			send("store/store.go", fsnotify.Write)
+			advance(3, 400*time.Millisecond)
+			Consistently(subject.Events()).ShouldNot(Receive())
+
+			send("store/store.go", fsnotify.Write)
+			advance(3, 200*time.Millisecond)
+			Eventually(subject.Events()).Should(Receive())
+		})
+	})
+
+	Describe("package resolution", func() {
+		It("emits one change per changed package", func() {
+			send("store/store.go", fsnotify.Write)
+			send("api/api.go", fsnotify.Write)
+			send("store/internal/db/db.go", fsnotify.Write)
+			advance(3, debounce)
+
+			var pkgs []string
+			for i := 0; i < 3; i++ {
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				pkgs = append(pkgs, change.Pkg)
+			}
+			Expect(pkgs).To(ConsistOf(
+				"example.com/watched/store",
+				"example.com/watched/api",
+				"example.com/watched/store/internal/db",
+			))
+		})
+
+		It("resolves the module's root package", func() {
+			write("doc.go", "package watched")
+			send("doc.go", fsnotify.Create)
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Pkg).To(Equal("example.com/watched"))
+		})
+
+		It("ignores changes to non-go files", func() {
+			send("store/README.md", fsnotify.Write)
+			advance(1, debounce)
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+	})
+
+	Describe("removed and renamed packages", func() {
+		It("emits the removal of a package directory", func() {
+			Expect(os.RemoveAll(path("store/internal"))).To(Succeed())
+			send("store/internal/db/db.go", fsnotify.Remove)
+			send("store/internal/db", fsnotify.Remove)
+			send("store/internal", fsnotify.Remove)
+			advance(3, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(PackageRemoved))
+			Expect(change.Pkg).To(Equal("example.com/watched/store/internal/db"))
+			Expect(change.Dir).To(Equal(path("store/internal/db")))
+			Expect(change.Files).To(Equal([]string{path("store/internal/db/db.go")}))
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+
+		It("emits the removal of a package moved out of the tree", func() {
+			Expect(os.RemoveAll(path("api"))).To(Succeed())
+			send("api", fsnotify.Rename)
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(PackageRemoved))
+			Expect(change.Pkg).To(Equal("example.com/watched/api"))
+		})
+
+		It("emits a package moved out of the tree and back again", func() {
+			outside, err := ioutil.TempDir("", "mcdev-pkgwatch-outside")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(outside)
+
+			Expect(os.Rename(path("api"), filepath.Join(outside, "api"))).To(Succeed())
+			send("api", fsnotify.Rename)
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(PackageRemoved))
+
+			Expect(os.Rename(filepath.Join(outside, "api"), path("api"))).To(Succeed())
+			send("api", fsnotify.Create)
+			advance(1, debounce)
+
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(PackageChanged))
+			Expect(change.Pkg).To(Equal("example.com/watched/api"))
+			Expect(source.Watched()).To(ContainElement(path("api")))
+		})
+
+		It("emits the removal of a package's last go file", func() {
+			write("store/README.md", "store")
+			Expect(os.Remove(path("store/store.go"))).To(Succeed())
+			send("store/store.go", fsnotify.Remove)
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(PackageRemoved))
+			Expect(change.Pkg).To(Equal("example.com/watched/store"))
+		})
+
+		It("stops watching removed directories", func() {
+			Expect(os.RemoveAll(path("store/internal"))).To(Succeed())
+			send("store/internal", fsnotify.Remove)
+			advance(1, debounce)
+
+			Eventually(source.Watched).Should(Equal([]string{
+				dir,
+				path("api"),
+				path("store"),
+			}))
+		})
+
+		It("emits a rename when a package is moved", func() {
+			Expect(os.Rename(path("api"), path("web"))).To(Succeed())
+			send("api", fsnotify.Rename)
+			send("web", fsnotify.Create)
+			advance(2, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(PackageRenamed))
+			Expect(change.Pkg).To(Equal("example.com/watched/web"))
+			Expect(change.Dir).To(Equal(path("web")))
+			Expect(change.OldPkg).To(Equal("example.com/watched/api"))
+			Expect(change.OldDir).To(Equal(path("api")))
+			Consistently(subject.Events()).ShouldNot(Receive())
+
+			Expect(source.Watched()).To(ContainElement(path("web")))
+			Expect(source.Watched()).NotTo(ContainElement(path("api")))
+		})
+	})
+
+	Describe("a closed source", func() {
+		It("stops the watcher", func() {
+			Expect(source.Close()).To(Succeed())
+			Eventually(finished).Should(BeClosed())
+			Expect(runErr).To(Equal(ErrSourceClosed))
+		})
+	})
+
+	Describe("rescanning", func() {
+		It("picks up the contents of new directories", func() {
+			write("cmd/server/main.go", "package main")
+			write("cmd/server/handlers/handlers.go", "package handlers")
+			send("cmd", fsnotify.Create)
+
+			Eventually(source.Watched).Should(ContainElement(path("cmd/server/handlers")))
+			advance(1, debounce)
+
+			var pkgs []string
+			for i := 0; i < 2; i++ {
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				Expect(change.Ops).To(Equal(Op(fsnotify.Create)))
+				pkgs = append(pkgs, change.Pkg)
+			}
+			Expect(pkgs).To(ConsistOf(
+				"example.com/watched/cmd/server",
+				"example.com/watched/cmd/server/handlers",
+			))
+		})
+
+		It("rescans everything when events are lost", func() {
+			write("api/api.go", "package api\n\nvar Changed = true\n")
+			write("api/v2/api.go", "package v2")
+			Expect(os.Remove(path("store/internal/db/db.go"))).To(Succeed())
+			Expect(os.Chtimes(path("api/api.go"), start, start.Add(time.Hour))).To(Succeed())
+
+			source.SendError(ErrOverflow)
+			advance(1, debounce)
+
+			ops := map[string]Op{}
+			for i := 0; i < 3; i++ {
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				ops[change.Pkg] = change.Ops
+			}
+			Expect(ops).To(Equal(map[string]Op{
+				"example.com/watched/api":               Op(fsnotify.Write),
+				"example.com/watched/api/v2":            Op(fsnotify.Create),
+				"example.com/watched/store/internal/db": Op(fsnotify.Remove),
+			}))
+			Expect(source.Watched()).To(ContainElement(path("api/v2")))
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+
+		It("treats events without a name as lost events", func() {
+			write("api/v2/api.go", "package v2")
+			source.Send(fsnotify.Event{})
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Pkg).To(Equal("example.com/watched/api/v2"))
+		})
+	})
+
+	Describe("editor saves", func() {
+		It("ignores temporary and lock files", func() {
+			for _, name := range []string{"4913", "5036", ".store.go.swp", "store.go~", "store.go___jb_tmp___", "#store.go#", ".#store.go"} {
+				write("store/"+name, "")
+				send("store/"+name, fsnotify.Create)
+			}
+			Consistently(clock.Waiters).Should(Equal(0))
+		})
+
+		It("counts a file renamed into place as written", func() {
+			send("store/store.go", fsnotify.Create)
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Ops).To(Equal(Op(fsnotify.Write)))
+		})
+
+		It("counts a file moved aside and rewritten as written", func() {
+			send("store/store.go", fsnotify.Rename)
+			send("store/store.go", fsnotify.Create)
+			send("store/store.go", fsnotify.Write)
+			advance(3, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Files).To(Equal([]string{path("store/store.go")}))
+			Expect(change.Ops).To(Equal(Op(fsnotify.Write)))
+		})
+
+		It("still emits removals", func() {
+			Expect(os.Remove(path("store/store.go"))).To(Succeed())
+			send("store/store.go", fsnotify.Remove)
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Ops).To(Equal(Op(fsnotify.Remove)))
+		})
+
+		Context("when skipping unchanged files", func() {
+			BeforeEach(func() {
+				subject.SkipUnchanged = true
+			})
+
+			It("ignores unchanged files renamed into place", func() {
+				send("store/store.go", fsnotify.Rename)
+				send("store/store.go", fsnotify.Create)
+				advance(2, debounce)
+				Consistently(subject.Events()).ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("mass changes", func() {
+		BeforeEach(func() {
+			subject.BurstThreshold = 2
+		})
+
+		It("emits changes below the threshold separately", func() {
+			send("store/store.go", fsnotify.Write)
+			send("api/api.go", fsnotify.Write)
+			advance(2, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(PackageChanged))
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(PackageChanged))
+		})
+
+		It("combines changes above the threshold into one", func() {
+			send("store/store.go", fsnotify.Write)
+			send("api/api.go", fsnotify.Write)
+			send("store/internal/db/db.go", fsnotify.Write)
+			advance(3, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(ManyChanged))
+			Expect(change.Pkg).To(Equal("example.com/watched/..."))
+			Expect(change.Dir).To(Equal(dir))
+			Expect(change.Pkgs).To(Equal([]string{
+				"example.com/watched/api",
+				"example.com/watched/store",
+				"example.com/watched/store/internal/db",
+			}))
+			Expect(change.Files).To(HaveLen(3))
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+
+		It("emits removed packages separately", func() {
+			subject.BurstThreshold = 1
+			Expect(os.Remove(path("api/api.go"))).To(Succeed())
+			send("api/api.go", fsnotify.Remove)
+			send("store/store.go", fsnotify.Write)
+			send("store/internal/db/db.go", fsnotify.Write)
+			advance(3, debounce)
+
+			var first, second Change
+			Eventually(subject.Events()).Should(Receive(&first))
+			Eventually(subject.Events()).Should(Receive(&second))
+			Expect(first.Kind).To(Equal(PackageRemoved))
+			Expect(first.Pkg).To(Equal("example.com/watched/api"))
+			Expect(second.Kind).To(Equal(ManyChanged))
+			Expect(second.Pkgs).To(Equal([]string{
+				"example.com/watched/store",
+				"example.com/watched/store/internal/db",
+			}))
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+
+		Context("when batching", func() {
+			BeforeEach(func() {
+				subject.BurstThreshold = 0
+				subject.Batch = true
+			})
+
+			It("emits the changes of a debounce window as one", func() {
+				send("store/store.go", fsnotify.Write)
+				send("api/api.go", fsnotify.Write)
+				advance(2, debounce)
+
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				Expect(change.Kind).To(Equal(ManyChanged))
+				Expect(change.Pkg).To(Equal("example.com/watched/..."))
+				Expect(change.Pkgs).To(Equal([]string{
+					"example.com/watched/api",
+					"example.com/watched/store",
+				}))
+				Consistently(subject.Events()).ShouldNot(Receive())
+			})
+
+			It("keeps the import path of a single package", func() {
+				send("store/store.go", fsnotify.Write)
+				advance(1, debounce)
+
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				Expect(change.Kind).To(Equal(ManyChanged))
+				Expect(change.Pkg).To(Equal("example.com/watched/store"))
+				Expect(change.Dir).To(Equal(path("store")))
+				Expect(change.Pkgs).To(Equal([]string{"example.com/watched/store"}))
+			})
+
+			It("emits module changes separately", func() {
+				send("go.mod", fsnotify.Write)
+				send("api/api.go", fsnotify.Write)
+				advance(2, debounce)
+
+				var first, second Change
+				Eventually(subject.Events()).Should(Receive(&first))
+				Eventually(subject.Events()).Should(Receive(&second))
+				Expect([]Kind{first.Kind, second.Kind}).To(Equal([]Kind{ModuleChanged, ManyChanged}))
+				Expect(second.Pkgs).To(Equal([]string{"example.com/watched/api"}))
+			})
+		})
+
+		Context("while git is busy", func() {
+			BeforeEach(func() {
+				subject.BurstThreshold = 0
+				subject.PauseForGit = true
+				write(".git/index.lock", "")
+			})
+
+			It("waits for git to finish, then emits a single change", func() {
+				send("store/store.go", fsnotify.Write)
+				send("api/api.go", fsnotify.Write)
+				advance(2, debounce)
+				Consistently(subject.Events()).ShouldNot(Receive())
+
+				Expect(os.Remove(path(".git/index.lock"))).To(Succeed())
+				advance(1, time.Second)
+
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				Expect(change.Kind).To(Equal(ManyChanged))
+				Expect(change.Pkgs).To(HaveLen(2))
+			})
+
+			It("detects rebases", func() {
+				Expect(os.Remove(path(".git/index.lock"))).To(Succeed())
+				write(".git/rebase-merge/head-name", "refs/heads/feature")
+
+				send("store/store.go", fsnotify.Write)
+				advance(1, debounce)
+				Consistently(subject.Events()).ShouldNot(Receive())
+
+				Expect(os.RemoveAll(path(".git/rebase-merge"))).To(Succeed())
+				advance(1, time.Second)
+
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				Expect(change.Pkg).To(Equal("example.com/watched/store"))
+			})
+
+			It("doesn't wait for a rebase stopped for a conflict or an edit", func() {
+				Expect(os.Remove(path(".git/index.lock"))).To(Succeed())
+				write(".git/rebase-merge/head-name", "refs/heads/feature")
+				write(".git/rebase-merge/stopped-sha", "0123456789abcdef")
+
+				send("store/store.go", fsnotify.Write)
+				advance(1, debounce)
+				Eventually(subject.Events()).Should(Receive())
+			})
+
+			It("doesn't wait for a rebase that stopped making progress", func() {
+				Expect(os.Remove(path(".git/index.lock"))).To(Succeed())
+				write(".git/rebase-apply/next", "2")
+				old := time.Now().Add(-time.Minute)
+				Expect(os.Chtimes(path(".git/rebase-apply"), old, old)).To(Succeed())
+
+				send("store/store.go", fsnotify.Write)
+				advance(1, debounce)
+				Eventually(subject.Events()).Should(Receive())
+			})
+
+			It("stops waiting for a lock file git left behind", func() {
+				send("store/store.go", fsnotify.Write)
+				advance(1, debounce)
+				for i := 0; i < 9; i++ {
+					advance(1, time.Second)
+				}
+				Consistently(subject.Events()).ShouldNot(Receive())
+
+				advance(1, time.Second)
+				Eventually(subject.Events()).Should(Receive())
+
+				// and ignores it from then on
+				send("api/api.go", fsnotify.Write)
+				advance(1, debounce)
+				Eventually(subject.Events()).Should(Receive())
+			})
+
+			Context("with a max wait", func() {
+				BeforeEach(func() {
+					subject.MaxWait = 2 * debounce
+				})
+
+				It("waits no longer than the max wait", func() {
+					send("store/store.go", fsnotify.Write)
+					advance(2, debounce)
+					Consistently(subject.Events()).ShouldNot(Receive())
+
+					advance(2, debounce)
+					Eventually(subject.Events()).Should(Receive())
+				})
+			})
+		})
+	})
+
+	Describe("module changes", func() {
+		It("emits a module change when go.mod changes", func() {
+			write("go.mod", "module example.com/watched\n\nrequire example.org/dep v1.0.0\n")
+			send("go.mod", fsnotify.Write)
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(ModuleChanged))
+			Expect(change.Module).To(Equal("example.com/watched"))
+			Expect(change.Pkg).To(Equal("example.com/watched/..."))
+			Expect(change.Dir).To(Equal(dir))
+			Expect(change.Files).To(Equal([]string{path("go.mod")}))
+		})
+
+		It("coalesces go.mod and go.sum changes", func() {
+			write("go.sum", "example.org/dep v1.0.0 h1:abc=\n")
+			send("go.mod", fsnotify.Write)
+			send("go.sum", fsnotify.Create)
+			advance(2, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Kind).To(Equal(ModuleChanged))
+			Expect(change.Files).To(HaveLen(2))
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+
+		It("emits package changes alongside", func() {
+			send("go.mod", fsnotify.Write)
+			send("api/api.go", fsnotify.Write)
+			advance(2, debounce)
+
+			kinds := map[string]Kind{}
+			for i := 0; i < 2; i++ {
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				kinds[change.Pkg] = change.Kind
+			}
+			Expect(kinds).To(Equal(map[string]Kind{
+				"example.com/watched/...": ModuleChanged,
+				"example.com/watched/api": PackageChanged,
+			}))
+		})
+
+		Context("when skipping unchanged files", func() {
+			BeforeEach(func() {
+				subject.SkipUnchanged = true
+			})
+
+			It("ignores rewrites of an unchanged go.mod", func() {
+				write("go.mod", "module example.com/watched\n")
+				send("go.mod", fsnotify.Write)
+				advance(1, debounce)
+				Consistently(subject.Events()).ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("multiple roots", func() {
+		var other string
+
+		BeforeEach(func() {
+			var err error
+			other, err = ioutil.TempDir("", "mcdev-pkgwatch-other")
+			Expect(err).To(BeNil())
+			other, err = filepath.EvalSymlinks(other)
+			Expect(err).To(BeNil())
+
+			Expect(ioutil.WriteFile(filepath.Join(other, "go.mod"), []byte("module example.com/other\n"), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(other, "lib"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(other, "lib", "lib.go"), []byte("package lib"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(other)
+		})
+
+		Context("when provided", func() {
+			BeforeEach(func() {
+				subject.Roots = []string{other}
+			})
+
+			It("watches them and resolves their packages", func() {
+				Eventually(source.Watched).Should(ContainElement(filepath.Join(other, "lib")))
+
+				source.Send(fsnotify.Event{Name: filepath.Join(other, "lib", "lib.go"), Op: fsnotify.Write})
+				advance(1, debounce)
+
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				Expect(change.Pkg).To(Equal("example.com/other/lib"))
+			})
+		})
+
+		Context("when named by a local replace directive", func() {
+			BeforeEach(func() {
+				write("go.mod", "module example.com/watched\n\nreplace example.com/other => ../"+filepath.Base(other)+"\n")
+			})
+
+			It("watches them", func() {
+				Eventually(source.Watched).Should(ContainElement(filepath.Join(other, "lib")))
+			})
+		})
+
+		Context("with symlinks", func() {
+			BeforeEach(func() {
+				Expect(os.Symlink(filepath.Join(other, "lib"), path("linked"))).To(Succeed())
+				Expect(os.Symlink(dir, path("store/loop"))).To(Succeed())
+			})
+
+			It("doesn't follow them by default", func() {
+				Eventually(source.Watched).Should(ContainElement(path("store/internal/db")))
+				Expect(source.Watched()).NotTo(ContainElement(path("linked")))
+			})
+
+			Context("when following them", func() {
+				BeforeEach(func() {
+					subject.FollowSymlinks = true
+				})
+
+				It("watches each directory once", func() {
+					Eventually(source.Watched).Should(Equal([]string{
+						dir,
+						path("api"),
+						path("linked"),
+						path("store"),
+						path("store/internal"),
+						path("store/internal/db"),
+					}))
+				})
+
+				It("doesn't watch a directory again when a link to it is created", func() {
+					Eventually(source.Watched).Should(ContainElement(path("linked")))
+					Expect(os.Symlink(path("api"), path("store/api"))).To(Succeed())
+					send("store/api", fsnotify.Create)
+					Expect(os.Symlink(filepath.Join(other, "lib"), path("api/lib"))).To(Succeed())
+					send("api/lib", fsnotify.Create)
+
+					Consistently(source.Watched).ShouldNot(ContainElement(path("store/api")))
+					Expect(source.Watched()).NotTo(ContainElement(path("api/lib")))
+				})
+
+				It("resolves packages by their linked path", func() {
+					send("linked/lib.go", fsnotify.Write)
+					advance(1, debounce)
+
+					var change Change
+					Eventually(subject.Events()).Should(Receive(&change))
+					Expect(change.Pkg).To(Equal("example.com/watched/linked"))
+				})
+			})
+		})
+	})
+
+	Describe("filtering", func() {
+		receivePkg := func() string {
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			return change.Pkg
+		}
+
+		Context("when including templates", func() {
+			BeforeEach(func() {
+				subject.IncludeFiles = []string{"*.go", "*.tmpl"}
+			})
+
+			It("maps a template to the package in its directory", func() {
+				write("api/index.tmpl", "{{.}}")
+				send("api/index.tmpl", fsnotify.Write)
+				advance(1, debounce)
+				Expect(receivePkg()).To(Equal("example.com/watched/api"))
+			})
+
+			It("maps a template to the package of its nearest ancestor", func() {
+				write("api/templates/index.tmpl", "{{.}}")
+				send("api/templates/index.tmpl", fsnotify.Write)
+				advance(1, debounce)
+				Expect(receivePkg()).To(Equal("example.com/watched/api"))
+			})
+
+			It("maps testdata to the package containing it", func() {
+				write("store/testdata/golden/fixture.tmpl", "{{.}}")
+				send("store/testdata/golden/fixture.tmpl", fsnotify.Write)
+				advance(1, debounce)
+				Expect(receivePkg()).To(Equal("example.com/watched/store"))
+			})
+
+			Context("underneath a testdata directory", func() {
+				BeforeEach(func() {
+					write("testdata/proj/go.mod", "module example.com/proj\n")
+					write("testdata/proj/api/api.go", "package api")
+					subject.Dir = path("testdata/proj")
+				})
+
+				It("only considers the directories underneath the root", func() {
+					send("testdata/proj/api/api.go", fsnotify.Write)
+					advance(1, debounce)
+					Expect(receivePkg()).To(Equal("example.com/proj/api"))
+
+					write("testdata/proj/api/templates/index.tmpl", "{{.}}")
+					send("testdata/proj/api/templates/index.tmpl", fsnotify.Write)
+					advance(1, debounce)
+					Expect(receivePkg()).To(Equal("example.com/proj/api"))
+				})
+			})
+		})
+
+		Context("when excluding generated files", func() {
+			BeforeEach(func() {
+				subject.ExcludeFiles = []string{"*_gen.go"}
+			})
+
+			It("ignores changes to them", func() {
+				write("store/store_gen.go", "package store")
+				send("store/store_gen.go", fsnotify.Write)
+				advance(1, debounce)
+				Consistently(subject.Events()).ShouldNot(Receive())
+			})
+		})
+
+		Context("when excluding directories by path", func() {
+			BeforeEach(func() {
+				subject.ExcludeDirs = append(DefaultExcludeDirs, "store/internal")
+			})
+
+			It("doesn't watch them", func() {
+				Eventually(source.Watched).Should(Equal([]string{
+					dir,
+					path("api"),
+					path("store"),
+				}))
+			})
+		})
+
+		Context("when honoring .gitignore", func() {
+			BeforeEach(func() {
+				subject.GitIgnore = true
+				Expect(os.MkdirAll(path(".git"), 0755)).To(Succeed())
+				write(".gitignore", "/store/internal/\n*_gen.go\n")
+			})
+
+			It("doesn't watch ignored directories", func() {
+				Eventually(source.Watched).Should(Equal([]string{
+					dir,
+					path("api"),
+					path("store"),
+				}))
+			})
+
+			It("ignores changes to ignored files", func() {
+				write("api/api_gen.go", "package api")
+				send("api/api_gen.go", fsnotify.Create)
+				advance(1, debounce)
+				Consistently(subject.Events()).ShouldNot(Receive())
+			})
+
+			It("watches directories that are no longer ignored", func() {
+				write(".gitignore", "*_gen.go\n")
+				send(".gitignore", fsnotify.Write)
+				Eventually(source.Watched).Should(ContainElement(path("store/internal/db")))
+			})
+		})
+
+		Context("when including vendor", func() {
+			BeforeEach(func() {
+				subject.IncludeDirs = []string{"vendor"}
+			})
+
+			It("watches vendored code", func() {
+				Eventually(source.Watched).Should(ContainElement(path("vendor/example.org/dep")))
+				Expect(source.Watched()).NotTo(ContainElement(path(".hidden")))
+			})
+		})
+	})
+
+	Describe("tracking imports", func() {
+		BeforeEach(func() {
+			subject.TrackImports = true
+			write("api/api.go", "package api\n\nimport _ \"example.com/watched/store\"\n")
+			write("store/store.go", "package store\n\nimport _ \"example.com/watched/store/internal/db\"\n")
+		})
+
+		It("emits changes in dependency order", func() {
+			send("api/api.go", fsnotify.Write)
+			send("store/store.go", fsnotify.Write)
+			send("store/internal/db/db.go", fsnotify.Write)
+			advance(3, debounce)
+
+			var pkgs []string
+			for i := 0; i < 3; i++ {
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				pkgs = append(pkgs, change.Pkg)
+			}
+			Expect(pkgs).To(Equal([]string{
+				"example.com/watched/store/internal/db",
+				"example.com/watched/store",
+				"example.com/watched/api",
+			}))
+		})
+
+		It("doesn't emit dependents", func() {
+			send("store/store.go", fsnotify.Write)
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Pkg).To(Equal("example.com/watched/store"))
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+	})
+
+	Describe("embedded files", func() {
+		BeforeEach(func() {
+			write("api/assets.go", "package api\n\nimport \"embed\"\n\n//go:embed templates\nvar templates embed.FS\n")
+			write("api/templates/index.html", "<html></html>")
+			write("store/store.go", "package store\n\nimport _ \"embed\"\n\n//go:embed migrations/*.sql\nvar schema string\n")
+			write("store/migrations/001_init.sql", "create table x;")
+			write("store/migrations/README.md", "migrations")
+		})
+
+		It("attributes changes to embedded files to the embedding package", func() {
+			send("api/templates/index.html", fsnotify.Write)
+			advance(1, debounce)
+
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Pkg).To(Equal("example.com/watched/api"))
+			Expect(change.Files).To(Equal([]string{path("api/templates/index.html")}))
+		})
+
+		It("matches the embed patterns", func() {
+			send("store/migrations/README.md", fsnotify.Write)
+			advance(1, debounce)
+			Consistently(subject.Events()).ShouldNot(Receive())
+
+			send("store/migrations/001_init.sql", fsnotify.Write)
+			advance(1, debounce)
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Pkg).To(Equal("example.com/watched/store"))
+		})
+
+		It("picks up new embed directives", func() {
+			write("api/api.go", "package api\n\nimport _ \"embed\"\n\n//go:embed api.json\nvar spec []byte\n")
+			send("api/api.go", fsnotify.Write)
+			advance(1, debounce)
+			Eventually(subject.Events()).Should(Receive())
+
+			write("api/api.json", "{}")
+			send("api/api.json", fsnotify.Create)
+			advance(1, debounce)
+			var change Change
+			Eventually(subject.Events()).Should(Receive(&change))
+			Expect(change.Pkg).To(Equal("example.com/watched/api"))
+		})
+	})
+
+	Describe("build constraints", func() {
+		BeforeEach(func() {
+			write("store/store_windows.go", "package store")
+			write("store/store_integration_test.go", "//go:build integration\n\npackage store\n")
+			subject.Build = NewBuildContext("linux", "amd64", nil)
+		})
+
+		It("ignores files excluded by their name", func() {
+			send("store/store_windows.go", fsnotify.Write)
+			advance(1, debounce)
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+
+		It("ignores files excluded by their build tags", func() {
+			send("store/store_integration_test.go", fsnotify.Write)
+			advance(1, debounce)
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+
+		It("emits files matching the context", func() {
+			send("store/store.go", fsnotify.Write)
+			advance(1, debounce)
+			Eventually(subject.Events()).Should(Receive())
+		})
+
+		It("emits changes that exclude a previously built file", func() {
+			write("store/store.go", "//go:build ignore\n\npackage store\n")
+			send("store/store.go", fsnotify.Write)
+			advance(1, debounce)
+			Eventually(subject.Events()).Should(Receive())
+		})
+
+		Context("with matching tags", func() {
+			BeforeEach(func() {
+				subject.Build = NewBuildContext("windows", "amd64", []string{"integration"})
+			})
+
+			It("emits the files", func() {
+				send("store/store_windows.go", fsnotify.Write)
+				send("store/store_integration_test.go", fsnotify.Write)
+				advance(2, debounce)
+
+				var change Change
+				Eventually(subject.Events()).Should(Receive(&change))
+				Expect(change.Files).To(HaveLen(2))
+			})
+		})
+	})
+
+	Describe("skipping unchanged files", func() {
+		BeforeEach(func() {
+			subject.SkipUnchanged = true
+		})
+
+		It("ignores writes that leave the content unchanged", func() {
+			write("store/store.go", "package store")
+			send("store/store.go", fsnotify.Write)
+			advance(1, debounce)
+			Consistently(subject.Events()).ShouldNot(Receive())
+		})
+
+		It("emits writes that change the content", func() {
+			write("store/store.go", "package store\n\n// Store stores\n")
+			send("store/store.go", fsnotify.Write)
+			advance(1, debounce)
+			Eventually(subject.Events()).Should(Receive())
+		})
+
+		It("emits removals", func() {
+			Expect(os.Remove(path("store/store.go"))).To(Succeed())
+			send("store/store.go", fsnotify.Remove)
+			advance(1, debounce)
+			Eventually(subject.Events()).Should(Receive())
+		})
+
+		Context("when ignoring formatting", func() {
+			BeforeEach(func() {
+				subject.IgnoreFormatting = true
+			})
+
+			It("ignores changes to comments and whitespace", func() {
+				write("store/store.go", "// Package store stores\npackage   store\n")
+				send("store/store.go", fsnotify.Write)
+				advance(1, debounce)
+				Consistently(subject.Events()).ShouldNot(Receive())
+			})
+
+			It("emits changes to the code", func() {
+				write("store/store.go", "package store\n\nvar Stored = true\n")
+				send("store/store.go", fsnotify.Write)
+				advance(1, debounce)
+				Eventually(subject.Events()).Should(Receive())
+			})
+		})
+	})
+})
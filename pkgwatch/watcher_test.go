@@ -0,0 +1,94 @@
+package pkgwatch_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	. "github.com/nullstyle/mcdev/pkgwatch"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pkgwatch.Watcher.Run", func() {
+	var (
+		subject    *Watcher
+		dir        string
+		ctx        context.Context
+		cancel     context.CancelFunc
+		result     chan error
+		finished   chan bool
+		goroutines int
+	)
+
+	write := func(path, contents string) {
+		path = filepath.Join(dir, path)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-pkgwatch")
+		Expect(err).To(BeNil())
+		dir, err = filepath.EvalSymlinks(dir)
+		Expect(err).To(BeNil())
+
+		write("go.mod", "module example.com/watched\n")
+		write("store/store.go", "package store")
+
+		goroutines = runtime.NumGoroutine()
+		subject = &Watcher{Dir: dir, Debounce: 20 * time.Millisecond}
+		Expect(subject.Init()).To(Succeed())
+
+		ctx, cancel = context.WithCancel(context.Background())
+		result = make(chan error, 1)
+		finished = make(chan bool)
+		go func(subject *Watcher, ctx context.Context, result chan error, finished chan bool) {
+			result <- subject.Run(ctx)
+			close(finished)
+		}(subject, ctx, result, finished)
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(finished).Should(BeClosed())
+		os.RemoveAll(dir)
+	})
+
+	It("emits the import path of changed packages", func() {
+		changes := subject.Changes()
+		Eventually(func() string {
+			write("store/store.go", "package store\n")
+			select {
+			case pkg := <-changes:
+				return pkg
+			case <-time.After(100 * time.Millisecond):
+				return ""
+			}
+		}).Should(Equal("example.com/watched/store"))
+	})
+
+	It("closes its channels and returns once cancelled", func() {
+		events := subject.Events()
+		changes := subject.Changes()
+
+		cancel()
+		Eventually(result).Should(Receive(BeNil()))
+		Eventually(events).Should(BeClosed())
+		Eventually(changes).Should(BeClosed())
+		Eventually(subject.Errors()).Should(BeClosed())
+	})
+
+	It("doesn't leak goroutines", func() {
+		subject.Changes()
+
+		cancel()
+		Eventually(result).Should(Receive(BeNil()))
+		Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", goroutines))
+	})
+})
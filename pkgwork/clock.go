@@ -0,0 +1,19 @@
+package pkgwork
+
+import (
+	"time"
+)
+
+// Clock provides a Worker with the current time and with timers, allowing the
+// passage of time to be controlled in tests.  It matches pkgwatch.Clock, so a
+// pkgwatch.FakeClock may be used.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock backed by the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
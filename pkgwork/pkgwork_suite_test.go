@@ -0,0 +1,13 @@
+package pkgwork_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPkgwork(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pkgwork Suite")
+}
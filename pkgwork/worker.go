@@ -1,99 +1,419 @@
 package pkgwork
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 )
 
+// Worker runs Fn for each package pushed to it, at most once concurrently per
+// package and no more often than once per Cooldown.
+//
+// Pushed packages wait in a first-in, first-out queue until they can be
+// started.  A package that is already waiting isn't queued again, and a
+// package pushed while it is running waits until that run completes.  With the
+// CancelPolicy, the running package's context is cancelled as well, so that it
+// is restarted as soon as possible.  A package pushed within Cooldown of its
+// last start is deferred until the cooldown expires, rather than dropped.  When
+// MaxParallel is non-zero, at most that many packages are run at once.
+//
+// When Dependencies is set, it must return every package that a package
+// imports, directly or transitively, and a queued package isn't started while
+// any of its dependencies is queued, cooling or running.  Fn may return
+// ErrFailed to report that a package failed without stopping the worker; if
+// Blocked is also set, it is called in place of Fn for a package that has a
+// dependency which failed after the package was queued.
+//
+// The context provided to Fn is also cancelled when Run's context is.  Clock
+// defaults to the time package, and may be replaced to control cooldowns in
+// tests.
 type Worker struct {
-	Fn       func(string) error
-	Cooldown time.Duration
+	Fn           func(context.Context, string) error
+	Cooldown     time.Duration
+	MaxParallel  int
+	Policy       Policy
+	Dependencies func(string) []string
+	Blocked      func(pkg, by string)
+	Clock        Clock
 
 	sync.Mutex
 
-	inited  bool
-	started map[string]time.Time
-	running map[string]bool
-	again   map[string]bool
+	inited bool
+	clock  Clock
+	queue  []string
+	pkgs   map[string]*entry
+	active int
+	wake   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// ErrFailed is returned by a Worker's Fn to report that a package failed.
+// Unlike other errors, it doesn't stop the worker.
+var ErrFailed = errors.New("package failed")
+
+// State is the state of a package within a Worker.  A package starts out Idle,
+// and moves:
+//
+//	Idle -> Queued     when pushed, outside of its cooldown
+//	Idle -> Cooling    when pushed, within its cooldown
+//	Cooling -> Queued  when its cooldown expires
+//	Queued -> Running  when started by Run
+//	Running -> Idle    when it completes
+//	Running -> Queued  when it completes, having been pushed while running and
+//	                   outside of its cooldown
+//	Running -> Cooling when it completes, having been pushed while running and
+//	                   within its cooldown
+//
+// Pushing a package that is already Queued or Cooling has no effect.
+type State int
+
+const (
+	// Idle packages are neither waiting nor running
+	Idle State = iota
+	// Queued packages are waiting to be started
+	Queued
+	// Running packages are being run by Fn
+	Running
+	// Cooling packages are waiting for their cooldown to expire before being
+	// queued
+	Cooling
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case Idle:
+		return "idle"
+	case Queued:
+		return "queued"
+	case Running:
+		return "running"
+	case Cooling:
+		return "cooling"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// entry tracks a single package's state
+type entry struct {
+	state    State
+	rerun    bool
+	queued   time.Time
+	started  time.Time
+	finished time.Time
+	failed   bool
+	cancel   context.CancelFunc
+	cooled   chan struct{}
+}
+
+// Policy selects what a Worker does when a package is pushed while it is
+// running
+type Policy int
+
+const (
+	// QueuePolicy lets the running package complete before running it again
+	QueuePolicy Policy = iota
+	// CancelPolicy cancels the running package before running it again
+	CancelPolicy
+)
+
+// String returns the name of the policy, as accepted by Set
+func (p Policy) String() string {
+	switch p {
+	case QueuePolicy:
+		return "queue"
+	case CancelPolicy:
+		return "cancel"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// Set parses the name of a policy, allowing a Policy to be used as a
+// flag.Value
+func (p *Policy) Set(name string) error {
+	switch name {
+	case "queue":
+		*p = QueuePolicy
+	case "cancel":
+		*p = CancelPolicy
+	default:
+		return fmt.Errorf("unknown policy %q, expected queue or cancel", name)
+	}
+	return nil
 }
 
 func (w *Worker) Init() {
+	w.Lock()
+	defer w.Unlock()
+
 	if w.inited {
 		return
 	}
 
-	w.started = map[string]time.Time{}
-	w.running = map[string]bool{}
-	w.again = map[string]bool{}
+	w.clock = w.Clock
+	if w.clock == nil {
+		w.clock = realClock{}
+	}
+	w.pkgs = map[string]*entry{}
+	w.wake = make(chan struct{}, 1)
 	w.inited = true
 }
 
-func (w *Worker) Run(pkg string) error {
+// Push schedules pkg to be run by the worker.  Packages may be pushed before
+// Run is called, but will not be started until it is.
+func (w *Worker) Push(pkg string) {
 	w.Init()
 
-	if !w.shouldStart(pkg) {
-		return nil
+	w.Lock()
+	e, ok := w.pkgs[pkg]
+	if !ok {
+		e = &entry{}
+		w.pkgs[pkg] = e
 	}
 
-	defer w.finish(pkg)
+	switch e.state {
+	case Idle:
+		w.enqueue(pkg, e)
+	case Running:
+		log.Printf("requeue: %s", pkg)
+		e.rerun = true
+		if w.Policy == CancelPolicy {
+			e.cancel()
+		}
+	}
+	w.Unlock()
+
+	w.signal()
+}
 
-	err := w.run(pkg)
-	if err != nil {
-		return err
+// State returns the current state of pkg
+func (w *Worker) State(pkg string) State {
+	w.Init()
+
+	w.Lock()
+	defer w.Unlock()
+
+	e, ok := w.pkgs[pkg]
+	if !ok {
+		return Idle
 	}
+	return e.state
+}
+
+// Run starts Fn for each pushed package until ctx is cancelled or Fn returns
+// an error.  Before returning, Run discards any packages that haven't been
+// started yet and waits for those that have to complete.
+func (w *Worker) Run(ctx context.Context) error {
+	w.Init()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer w.drain()
+	defer w.wg.Wait()
+	defer cancel()
+
+	errs := make(chan error, 1)
+
+	for {
+		w.startReady(ctx, func(ctx context.Context, pkg string) {
+			defer w.wg.Done()
+
+			err := w.run(ctx, pkg)
+			cancelled := ctx.Err() != nil
+			w.finish(pkg, err)
+
+			// a cancelled run's failure is expected
+			if err != nil && err != ErrFailed && !cancelled {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+		})
 
-	for w.shouldRunAgain(pkg) {
-		err := w.run(pkg)
-		if err != nil {
+		select {
+		case <-w.wake:
+		case err := <-errs:
 			return err
+		case <-ctx.Done():
+			return nil
 		}
 	}
-	return nil
 }
 
-func (w *Worker) run(pkg string) error {
-	err := w.Fn(pkg)
-	return err
+// enqueue moves e, which must not be running, to the back of the queue, or has
+// it cool down first if pkg was started within the cooldown.  The caller must
+// hold the lock.
+func (w *Worker) enqueue(pkg string, e *entry) {
+	now := w.clock.Now()
+	e.queued = now
+
+	remaining := w.Cooldown - now.Sub(e.started)
+	if !e.started.IsZero() && remaining > 0 {
+		stop := make(chan struct{})
+		expired := w.clock.After(remaining)
+		e.state = Cooling
+		e.cooled = stop
+		go func() {
+			select {
+			case <-expired:
+				w.cool(pkg, e, stop)
+			case <-stop:
+			}
+		}()
+		return
+	}
+
+	e.state = Queued
+	w.queue = append(w.queue, pkg)
 }
 
-func (w *Worker) finish(pkg string) {
+// cool queues e once the cooldown that stop belongs to has expired
+func (w *Worker) cool(pkg string, e *entry, stop chan struct{}) {
 	w.Lock()
-	delete(w.running, pkg)
-	delete(w.again, pkg)
+	if e.state != Cooling || e.cooled != stop {
+		w.Unlock()
+		return
+	}
+	e.cooled = nil
+	e.state = Queued
+	w.queue = append(w.queue, pkg)
 	w.Unlock()
+
+	w.signal()
 }
 
-func (w *Worker) shouldRunAgain(pkg string) bool {
+// startReady starts, in queue order, each queued package that isn't waiting
+// for its dependencies, for as long as the parallelism limit allows.
+func (w *Worker) startReady(ctx context.Context, start func(context.Context, string)) {
 	w.Lock()
-	again := w.again[pkg]
-	w.again[pkg] = false
-	w.Unlock()
-	return again
+	defer w.Unlock()
+
+	remaining := w.queue[:0]
+	for i, pkg := range w.queue {
+		if w.MaxParallel > 0 && w.active >= w.MaxParallel {
+			remaining = append(remaining, w.queue[i:]...)
+			break
+		}
+
+		if w.waitsForDependency(pkg) {
+			remaining = append(remaining, pkg)
+			continue
+		}
+
+		e := w.pkgs[pkg]
+		runCtx, cancel := context.WithCancel(ctx)
+		e.state = Running
+		e.started = w.clock.Now()
+		e.cancel = cancel
+		w.active++
+		w.wg.Add(1)
+		go start(runCtx, pkg)
+	}
+	w.queue = remaining
+}
+
+// waitsForDependency returns true if one of pkg's dependencies is pending,
+// ignoring those that depend on pkg in turn.  The caller must hold the lock.
+func (w *Worker) waitsForDependency(pkg string) bool {
+	if w.Dependencies == nil {
+		return false
+	}
+
+	for _, dep := range w.Dependencies(pkg) {
+		e, ok := w.pkgs[dep]
+		if !ok || e.state == Idle {
+			continue
+		}
+		if !contains(w.Dependencies(dep), pkg) {
+			return true
+		}
+	}
+	return false
 }
 
-func (w *Worker) shouldStart(pkg string) bool {
+// blocker returns a dependency of pkg that failed since pkg was queued.
+func (w *Worker) blocker(pkg string) (string, bool) {
+	if w.Dependencies == nil || w.Blocked == nil {
+		return "", false
+	}
+
 	w.Lock()
+	defer w.Unlock()
+
+	queued := w.pkgs[pkg].queued
+	for _, dep := range w.Dependencies(pkg) {
+		e, ok := w.pkgs[dep]
+		if ok && e.failed && e.finished.After(queued) {
+			return dep, true
+		}
+	}
+	return "", false
+}
 
-	startedAt := w.started[pkg]
-	alreadyRunning := w.running[pkg]
-	coolEnough := time.Since(startedAt) > w.Cooldown
+func (w *Worker) run(ctx context.Context, pkg string) error {
+	if by, blocked := w.blocker(pkg); blocked {
+		w.Blocked(pkg, by)
+		return nil
+	}
 
-	if !coolEnough {
-		w.Unlock()
-		return false
+	err := w.Fn(ctx, pkg)
+	return err
+}
+
+// signal wakes Run to start any packages that are ready
+func (w *Worker) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
 	}
+}
 
-	if alreadyRunning {
-		log.Printf("requeue: %s", pkg)
-		w.again[pkg] = true
+// drain discards any queued or cooling packages
+func (w *Worker) drain() {
+	w.Lock()
+	defer w.Unlock()
 
-		w.Unlock()
-		return false
+	w.queue = nil
+	for _, e := range w.pkgs {
+		if e.cooled != nil {
+			close(e.cooled)
+			e.cooled = nil
+		}
+		if e.state != Running {
+			e.state = Idle
+		}
 	}
+}
+
+func (w *Worker) finish(pkg string, err error) {
+	w.Lock()
+	e := w.pkgs[pkg]
+	e.cancel()
+	e.cancel = nil
+	e.failed = err == ErrFailed
+	e.finished = w.clock.Now()
+	w.active--
 
-	w.started[pkg] = time.Now()
-	w.running[pkg] = true
+	e.state = Idle
+	if e.rerun {
+		e.rerun = false
+		w.enqueue(pkg, e)
+	}
 	w.Unlock()
-	return true
+
+	w.signal()
+}
+
+func contains(pkgs []string, pkg string) bool {
+	for _, p := range pkgs {
+		if p == pkg {
+			return true
+		}
+	}
+	return false
 }
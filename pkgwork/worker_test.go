@@ -0,0 +1,455 @@
+package pkgwork_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/nullstyle/mcdev/pkgwatch"
+	. "github.com/nullstyle/mcdev/pkgwork"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pkgwork.Worker.Run", func() {
+	var (
+		subject    *Worker
+		ctx        context.Context
+		cancel     context.CancelFunc
+		result     chan error
+		finished   chan bool
+		goroutines int
+
+		lock      sync.Mutex
+		ran       []string
+		cancelled []string
+		release   chan bool
+	)
+
+	BeforeEach(func() {
+		goroutines = runtime.NumGoroutine()
+		ran = nil
+		cancelled = nil
+		release = make(chan bool)
+		wait := release
+		subject = &Worker{
+			Fn: func(ctx context.Context, pkg string) error {
+				lock.Lock()
+				ran = append(ran, pkg)
+				lock.Unlock()
+
+				select {
+				case <-wait:
+					return nil
+				case <-ctx.Done():
+					lock.Lock()
+					cancelled = append(cancelled, pkg)
+					lock.Unlock()
+					return ctx.Err()
+				}
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		result = make(chan error, 1)
+		finished = make(chan bool)
+		go func(subject *Worker, ctx context.Context, result chan error, finished chan bool) {
+			result <- subject.Run(ctx)
+			close(finished)
+		}(subject, ctx, result, finished)
+	})
+
+	AfterEach(func() {
+		cancel()
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+		Eventually(finished).Should(BeClosed())
+	})
+
+	runs := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, ran...)
+	}
+
+	cancellations := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, cancelled...)
+	}
+
+	It("runs Fn for each pushed package", func() {
+		close(release)
+		subject.Push("a")
+		subject.Push("b")
+		Eventually(runs).Should(ConsistOf("a", "b"))
+	})
+
+	It("waits for in-flight runs to complete after being cancelled", func() {
+		subject.Fn = func(ctx context.Context, pkg string) error {
+			lock.Lock()
+			ran = append(ran, pkg)
+			lock.Unlock()
+			<-release
+			return nil
+		}
+
+		subject.Push("a")
+		Eventually(runs).Should(ConsistOf("a"))
+
+		cancel()
+		Consistently(result).ShouldNot(Receive())
+
+		close(release)
+		Eventually(result).Should(Receive(BeNil()))
+	})
+
+	It("cancels in-flight runs after being cancelled", func() {
+		subject.Push("a")
+		Eventually(runs).Should(ConsistOf("a"))
+
+		cancel()
+		Eventually(result).Should(Receive(BeNil()))
+		Expect(cancellations()).To(ConsistOf("a"))
+	})
+
+	It("doesn't leak goroutines", func() {
+		close(release)
+		subject.Push("a")
+		Eventually(runs).Should(ConsistOf("a"))
+
+		cancel()
+		Eventually(result).Should(Receive(BeNil()))
+		Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", goroutines))
+	})
+
+	Context("with a parallelism limit", func() {
+		BeforeEach(func() {
+			subject.MaxParallel = 2
+		})
+
+		It("queues the packages that exceed it", func() {
+			subject.Push("a")
+			subject.Push("b")
+			subject.Push("c")
+			Eventually(runs).Should(ConsistOf("a", "b"))
+			Consistently(runs).Should(HaveLen(2))
+			Expect(subject.State("c")).To(Equal(Queued))
+
+			release <- true
+			Eventually(runs).Should(ConsistOf("a", "b", "c"))
+		})
+
+		Context("of one", func() {
+			BeforeEach(func() {
+				subject.MaxParallel = 1
+			})
+
+			It("runs queued packages in the order they were pushed, once each", func() {
+				subject.Push("a")
+				Eventually(runs).Should(HaveLen(1))
+
+				subject.Push("b")
+				subject.Push("d")
+				subject.Push("c")
+				subject.Push("d")
+				close(release)
+				Eventually(runs).Should(Equal([]string{"a", "b", "d", "c"}))
+				Consistently(runs).Should(HaveLen(4))
+			})
+		})
+	})
+
+	It("reruns a package pushed while it is running once it completes", func() {
+		subject.Push("a")
+		Eventually(runs).Should(Equal([]string{"a"}))
+
+		subject.Push("a")
+		subject.Push("a")
+		Consistently(runs).Should(HaveLen(1))
+
+		close(release)
+		Eventually(runs).Should(Equal([]string{"a", "a"}))
+		Consistently(runs).Should(HaveLen(2))
+	})
+
+	Context("with the cancel policy", func() {
+		BeforeEach(func() {
+			subject.Policy = CancelPolicy
+		})
+
+		It("cancels a package pushed while it is running, then reruns it", func() {
+			subject.Push("a")
+			Eventually(runs).Should(Equal([]string{"a"}))
+
+			subject.Push("a")
+			Eventually(cancellations).Should(Equal([]string{"a"}))
+			Eventually(runs).Should(Equal([]string{"a", "a"}))
+
+			close(release)
+			Consistently(runs).Should(HaveLen(2))
+			Consistently(result).ShouldNot(Receive())
+		})
+
+		It("leaves other packages running", func() {
+			subject.Push("a")
+			subject.Push("b")
+			Eventually(runs).Should(ConsistOf("a", "b"))
+
+			subject.Push("b")
+			Eventually(cancellations).Should(Equal([]string{"b"}))
+		})
+	})
+
+	Context("with a cooldown", func() {
+		var (
+			cooldown = 300 * time.Millisecond
+			clock    *pkgwatch.FakeClock
+			times    []time.Time
+		)
+
+		BeforeEach(func() {
+			times = nil
+			clock = pkgwatch.NewFakeClock(time.Unix(1000, 0))
+			subject.Clock = clock
+			subject.Cooldown = cooldown
+			inner := subject.Fn
+			subject.Fn = func(ctx context.Context, pkg string) error {
+				lock.Lock()
+				times = append(times, clock.Now())
+				lock.Unlock()
+				return inner(ctx, pkg)
+			}
+		})
+
+		gap := func() time.Duration {
+			lock.Lock()
+			defer lock.Unlock()
+			return times[1].Sub(times[0])
+		}
+
+		state := func(pkg string) func() State {
+			return func() State { return subject.State(pkg) }
+		}
+
+		It("defers a package pushed during its cooldown until it expires", func() {
+			close(release)
+			subject.Push("a")
+			Eventually(runs).Should(HaveLen(1))
+			Eventually(state("a")).Should(Equal(Idle))
+
+			subject.Push("a")
+			Expect(subject.State("a")).To(Equal(Cooling))
+			Eventually(clock.Waiters).Should(Equal(1))
+			clock.Advance(cooldown - time.Millisecond)
+			Consistently(runs).Should(HaveLen(1))
+
+			clock.Advance(time.Millisecond)
+			Eventually(runs).Should(Equal([]string{"a", "a"}))
+			Expect(gap()).To(Equal(cooldown))
+		})
+
+		It("runs a deferred package once, however often it is pushed", func() {
+			close(release)
+			subject.Push("a")
+			Eventually(runs).Should(HaveLen(1))
+			Eventually(state("a")).Should(Equal(Idle))
+
+			subject.Push("a")
+			subject.Push("a")
+			subject.Push("a")
+			Expect(clock.Waiters()).To(Equal(1))
+
+			clock.Advance(cooldown)
+			Eventually(runs).Should(HaveLen(2))
+			Consistently(runs).Should(HaveLen(2))
+		})
+
+		It("defers a package pushed while running until its cooldown expires", func() {
+			subject.Push("a")
+			Eventually(runs).Should(HaveLen(1))
+			Expect(subject.State("a")).To(Equal(Running))
+
+			subject.Push("a")
+			close(release)
+			Eventually(state("a")).Should(Equal(Cooling))
+			Consistently(runs).Should(HaveLen(1))
+
+			clock.Advance(cooldown)
+			Eventually(runs).Should(Equal([]string{"a", "a"}))
+			Expect(gap()).To(Equal(cooldown))
+		})
+
+		It("doesn't delay a package pushed after its cooldown expired", func() {
+			close(release)
+			subject.Push("a")
+			Eventually(runs).Should(HaveLen(1))
+			Eventually(state("a")).Should(Equal(Idle))
+
+			clock.Advance(cooldown)
+			subject.Push("a")
+			Expect(subject.State("a")).NotTo(Equal(Cooling))
+			Eventually(runs).Should(HaveLen(2))
+			Expect(clock.Waiters()).To(Equal(0))
+		})
+
+		It("doesn't delay other packages", func() {
+			close(release)
+			subject.Push("a")
+			Eventually(runs).Should(HaveLen(1))
+			Eventually(state("a")).Should(Equal(Idle))
+
+			subject.Push("a")
+			subject.Push("b")
+			Eventually(runs).Should(Equal([]string{"a", "b"}))
+			Consistently(runs).Should(Equal([]string{"a", "b"}))
+
+			clock.Advance(cooldown)
+			Eventually(runs).Should(Equal([]string{"a", "b", "a"}))
+		})
+
+		It("discards cooling packages when cancelled", func() {
+			close(release)
+			subject.Push("a")
+			Eventually(runs).Should(HaveLen(1))
+			Eventually(state("a")).Should(Equal(Idle))
+
+			subject.Push("a")
+			cancel()
+			Eventually(result).Should(Receive(BeNil()))
+			Expect(subject.State("a")).To(Equal(Idle))
+
+			clock.Advance(cooldown)
+			Consistently(runs).Should(HaveLen(1))
+		})
+	})
+
+	Context("with dependencies", func() {
+		var (
+			deps    map[string][]string
+			blocked []string
+		)
+
+		BeforeEach(func() {
+			blocked = nil
+			deps = map[string][]string{
+				"api":   {"db", "store"},
+				"store": {"db"},
+			}
+			subject.Dependencies = func(pkg string) []string {
+				return deps[pkg]
+			}
+		})
+
+		It("runs packages after the queued packages they depend on", func() {
+			subject.Push("api")
+			subject.Push("store")
+			subject.Push("db")
+			subject.Push("other")
+			Eventually(runs).Should(ConsistOf("db", "other"))
+			Expect(subject.State("api")).To(Equal(Queued))
+
+			release <- true
+			release <- true
+			Eventually(runs).Should(ConsistOf("db", "other", "store"))
+
+			release <- true
+			Eventually(runs).Should(ConsistOf("db", "other", "store", "api"))
+		})
+
+		It("doesn't wait for dependencies that aren't queued", func() {
+			subject.Push("api")
+			Eventually(runs).Should(Equal([]string{"api"}))
+		})
+
+		It("doesn't wait on import cycles", func() {
+			deps["db"] = []string{"api", "store"}
+			subject.Push("api")
+			subject.Push("db")
+			Eventually(runs).Should(ConsistOf("api", "db"))
+		})
+
+		Context("when a dependency fails", func() {
+			BeforeEach(func() {
+				subject.Fn = func(ctx context.Context, pkg string) error {
+					lock.Lock()
+					ran = append(ran, pkg)
+					lock.Unlock()
+					if pkg == "db" {
+						return ErrFailed
+					}
+					return nil
+				}
+				subject.Blocked = func(pkg, by string) {
+					lock.Lock()
+					blocked = append(blocked, pkg+" by "+by)
+					lock.Unlock()
+				}
+			})
+
+			blocks := func() []string {
+				lock.Lock()
+				defer lock.Unlock()
+				return append([]string{}, blocked...)
+			}
+
+			It("skips the packages that were queued with it", func() {
+				subject.Push("api")
+				subject.Push("db")
+				subject.Push("store")
+				Eventually(blocks).Should(ConsistOf("api by db", "store by db"))
+				Expect(runs()).To(Equal([]string{"db"}))
+				Consistently(result).ShouldNot(Receive())
+			})
+
+			It("runs the packages queued after it failed", func() {
+				subject.Push("db")
+				Eventually(runs).Should(Equal([]string{"db"}))
+				Eventually(func() State { return subject.State("db") }).Should(Equal(Idle))
+
+				subject.Push("api")
+				Eventually(runs).Should(Equal([]string{"db", "api"}))
+				Expect(blocks()).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("when Fn fails", func() {
+		BeforeEach(func() {
+			subject.Fn = func(ctx context.Context, pkg string) error {
+				return errors.New("boom")
+			}
+		})
+
+		It("returns the error", func() {
+			subject.Push("a")
+			Eventually(result).Should(Receive(MatchError("boom")))
+		})
+	})
+
+	Context("when Fn reports a failed package", func() {
+		BeforeEach(func() {
+			subject.Fn = func(ctx context.Context, pkg string) error {
+				lock.Lock()
+				ran = append(ran, pkg)
+				lock.Unlock()
+				return ErrFailed
+			}
+		})
+
+		It("keeps running", func() {
+			subject.Push("a")
+			subject.Push("b")
+			Eventually(runs).Should(ConsistOf("a", "b"))
+			Consistently(result).ShouldNot(Receive())
+		})
+	})
+})
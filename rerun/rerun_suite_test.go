@@ -0,0 +1,13 @@
+package rerun_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRerun(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Rerun Suite")
+}
@@ -1,15 +1,20 @@
 package rerun
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/exec"
 	"time"
 )
 
-// Runner attempts to keep the provided command running.  After Start() is
-// called the underylying process will be restarted as requested as well as each
-// time it exits.
+// ShutdownTimeout is how long Run waits for the process to exit after being
+// interrupted during shutdown, after which the process is killed.
+var ShutdownTimeout = 10 * time.Second
+
+// Runner attempts to keep the provided command running.  While Run() is
+// running the underylying process will be restarted as requested as well as
+// each time it exits.
 //
 // The configured cooldown will trigger when a restart is triggered due to the
 // process exiting.  Manually triggered restarts--calling Restart()--will occur
@@ -19,12 +24,10 @@ type Runner struct {
 	cmd      *exec.Cmd
 	cooldown time.Duration
 
-	exit      chan error
-	restart   chan bool
-	dontWait  bool
-	finishing bool
-	finished  bool
-	current   *exec.Cmd
+	exit     chan error
+	restart  chan bool
+	dontWait bool
+	current  *exec.Cmd
 }
 
 // NewRunner constructs a new rerun service
@@ -33,119 +36,120 @@ func NewRunner(cmd *exec.Cmd, cooldown time.Duration) *Runner {
 		cmd:      cmd,
 		cooldown: cooldown,
 		exit:     make(chan error, 1),
-		restart:  make(chan bool),
+		restart:  make(chan bool, 1),
 		current:  nil,
 	}
 }
 
-// Start causes the underlying Cmd to be started
-func (r *Runner) Start() {
-	if r.current != nil {
-		return
-	}
-
-	go r.run()
-}
-
-// Restart causes the undelying process to stop and restart immediately
+// Restart causes the undelying process to stop and restart immediately.
+// Restarts requested while a previous one is still pending are coalesced.
 func (r *Runner) Restart() {
-	r.dontWait = true
-	r.restart <- true
-}
-
-// Shutdown kills this service runner and waits until it is complete
-func (r *Runner) Shutdown() {
-	close(r.restart)
-
-	done := make(chan bool, 1)
-	go func() {
-		for {
-			if r.finished {
-				done <- true
-				return
-			}
-			<-time.After(1 * time.Second)
-		}
-	}()
-	<-done
+	select {
+	case r.restart <- true:
+	default:
+	}
 }
 
-func (r *Runner) run() {
-	r.start()
+// Run starts the underlying process and keeps it running until ctx is
+// cancelled, at which point the process is interrupted and Run returns once
+// it has exited.  An error is returned if the process could not be started.
+func (r *Runner) Run(ctx context.Context) error {
+	err := r.start(ctx)
+	if err != nil {
+		return err
+	}
 
 	for {
 		select {
 		case err := <-r.exit:
-			r.finishProcess(err)
 			r.current = nil
-			r.start()
-		case _, more := <-r.restart:
-			// if the restart channel closed, shutdown
-			if !more {
-				r.shuttingDown()
-				return
+			err = r.finishProcess(err)
+			if err != nil {
+				return err
 			}
 
+			err = r.start(ctx)
+			if err != nil {
+				return err
+			}
+		case <-r.restart:
+			r.dontWait = true
 			r.stop()
+		case <-ctx.Done():
+			r.shuttingDown()
+			return nil
 		}
 	}
 }
 
 func (r *Runner) shuttingDown() {
-	r.finishing = true
+	if r.current == nil {
+		return
+	}
+
 	r.stop()
 	select {
 	case err := <-r.exit:
 		r.finishProcess(err)
-		r.finished = true
-		log.Println("shutdown complete")
-	case <-time.After(10 * time.Second):
-		log.Fatalln("shutdown did not complete before 10 seconds elapsed")
+	case <-time.After(ShutdownTimeout):
+		log.Printf("shutdown did not complete before %s elapsed, killing", ShutdownTimeout)
+		r.current.Process.Kill()
+		r.finishProcess(<-r.exit)
 	}
+	r.current = nil
+	log.Println("shutdown complete")
 }
 
-func (r *Runner) finishProcess(err error) {
-	var msg interface{}
-	var isFatal bool
+// finishProcess logs the result of the process, returning an error if the
+// process couldn't be run at all.
+func (r *Runner) finishProcess(err error) error {
+	r.LastErr = err
 
 	if err == nil {
-		msg = "exitted successfully"
-		isFatal = false
-	} else if _, ok := err.(*exec.ExitError); ok {
-		msg = err
-		isFatal = false
-	} else {
-		msg = err
-		isFatal = true
+		log.Println("exitted successfully")
+		return nil
 	}
 
-	if isFatal {
-		log.Fatalln(msg)
+	if _, ok := err.(*exec.ExitError); ok {
+		log.Println(err)
+		return nil
 	}
 
-	log.Println(msg)
+	return err
 }
 
 func (r *Runner) stop() {
+	if r.current == nil {
+		return
+	}
+
 	log.Println("stopping service")
 	r.current.Process.Signal(os.Interrupt)
 }
 
-func (r *Runner) start() {
-	if r.finishing {
-		return
+// start starts a new process, waiting for the cooldown to elapse unless a
+// restart was requested.  If ctx is cancelled while cooling down, no process
+// is started.
+func (r *Runner) start(ctx context.Context) error {
+	if !r.dontWait {
+		select {
+		case <-time.After(r.cooldown):
+		case <-ctx.Done():
+			return nil
+		}
 	}
+	r.dontWait = false
 
 	next := *r.cmd
-	r.current = &next
-
-	if !r.dontWait {
-		<-time.After(r.cooldown)
+	log.Println("starting service")
+	err := next.Start()
+	if err != nil {
+		return err
 	}
-	r.dontWait = false
+	r.current = &next
 
 	go func() {
-		log.Println("starting service")
-		r.exit <- r.current.Run()
+		r.exit <- next.Wait()
 	}()
+	return nil
 }
@@ -0,0 +1,97 @@
+package rerun_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	. "github.com/nullstyle/mcdev/rerun"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("rerun.Runner.Run", func() {
+	var (
+		subject    *Runner
+		ctx        context.Context
+		cancel     context.CancelFunc
+		result     chan error
+		finished   chan bool
+		goroutines int
+		dir        string
+	)
+
+	run := func(subject *Runner, ctx context.Context) {
+		result = make(chan error, 1)
+		finished = make(chan bool)
+		go func(result chan error, finished chan bool) {
+			result <- subject.Run(ctx)
+			close(finished)
+		}(result, finished)
+	}
+
+	// starts returns how many times the process has been started
+	starts := func() int {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, "starts"))
+		return strings.Count(string(data), "x")
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mcdev-rerun")
+		Expect(err).To(BeNil())
+
+		goroutines = runtime.NumGoroutine()
+		cmd := exec.Command("sh", "-c", "echo x >> starts; exec sleep 30")
+		cmd.Dir = dir
+		subject = NewRunner(cmd, 10*time.Millisecond)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		run(subject, ctx)
+		Eventually(starts).Should(Equal(1))
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(finished, 5*time.Second).Should(BeClosed())
+		os.RemoveAll(dir)
+	})
+
+	It("restarts the process when requested", func() {
+		subject.Restart()
+		Eventually(starts).Should(Equal(2))
+	})
+
+	It("stops the process and returns once cancelled", func() {
+		cancel()
+		Eventually(result, 5*time.Second).Should(Receive(BeNil()))
+		Consistently(starts).Should(Equal(1))
+	})
+
+	It("doesn't leak goroutines", func() {
+		cancel()
+		Eventually(result, 5*time.Second).Should(Receive(BeNil()))
+		Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", goroutines))
+	})
+
+	Context("when the command can't be started", func() {
+		BeforeEach(func() {
+			cancel()
+			Eventually(result, 5*time.Second).Should(Receive())
+
+			ctx, cancel = context.WithCancel(context.Background())
+			subject = NewRunner(exec.Command(filepath.Join(dir, "missing")), 0)
+			run(subject, ctx)
+		})
+
+		It("returns an error", func() {
+			Eventually(result).Should(Receive(HaveOccurred()))
+		})
+	})
+})